@@ -0,0 +1,82 @@
+{{/*
+Environment of the machine config server, shared by the standalone server and the operator embedding it.
+*/}}
+{{- define "talos-cluster-operator.serverEnv" -}}
+- name: TALOS_SERVER_NAMESPACE
+  value: {{ .Release.Namespace }}
+{{- with .Values.machines.cidr }}
+- name: TALOS_SERVER_MACHINE_CIDR
+  value: {{ . | quote }}
+{{- end }}
+{{- with .Values.machines.subnetSize }}
+- name: TALOS_SERVER_MACHINE_SUBNET_SIZE
+  value: {{ . | quote }}
+{{- end }}
+- name: TALOS_SERVER_MACHINE_NAMESPACE
+  value: {{ .Values.machines.namespace }}
+{{- with .Values.machines.network.gateway }}
+- name: TALOS_SERVER_MACHINE_GATEWAY
+  value: {{ . | quote }}
+{{- end }}
+{{- with .Values.machines.network.nameservers }}
+- name: TALOS_SERVER_MACHINE_NAMESERVERS
+  value: {{ join "," . | quote }}
+{{- end }}
+{{- with .Values.machines.network.vlan }}
+- name: TALOS_SERVER_MACHINE_VLAN
+  value: {{ . | quote }}
+{{- end }}
+{{- with .Values.machines.network.bond.mode }}
+- name: TALOS_SERVER_MACHINE_BOND_MODE
+  value: {{ . | quote }}
+{{- end }}
+{{- with .Values.machines.network.bond.driver }}
+- name: TALOS_SERVER_MACHINE_BOND_DRIVER
+  value: {{ . | quote }}
+{{- end }}
+{{- with .Values.machines.nameTemplate }}
+- name: TALOS_SERVER_MACHINE_NAME_TEMPLATE
+  value: {{ . | quote }}
+{{- end }}
+{{- with .Values.server.limits.maxConcurrentRenders }}
+- name: TALOS_SERVER_MAX_CONCURRENT_RENDERS
+  value: {{ . | quote }}
+{{- end }}
+{{- with .Values.server.limits.rateLimit }}
+- name: TALOS_SERVER_RATE_LIMIT
+  value: {{ . | quote }}
+{{- end }}
+{{- with .Values.server.limits.rateLimitBurst }}
+- name: TALOS_SERVER_RATE_LIMIT_BURST
+  value: {{ . | quote }}
+{{- end }}
+- name: TALOS_SERVER_AUDIT_SINKS
+  value: {{ join "," .Values.server.audit.sinks | quote }}
+{{- with .Values.server.audit.file }}
+- name: TALOS_SERVER_AUDIT_FILE
+  value: {{ . | quote }}
+{{- end }}
+{{- with .Values.server.audit.webhookURL }}
+- name: TALOS_SERVER_AUDIT_WEBHOOK_URL
+  value: {{ . | quote }}
+{{- end }}
+{{- if .Values.server.boot.enabled }}
+- name: TALOS_SERVER_BOOT_ENABLED
+  value: "true"
+{{- with .Values.server.boot.baseURL }}
+- name: TALOS_SERVER_BOOT_BASE_URL
+  value: {{ . | quote }}
+{{- end }}
+{{- end }}
+{{- if .Values.server.proxyDHCP.enabled }}
+{{- if not .Values.server.boot.enabled }}
+{{- fail "server.proxyDHCP requires server.boot.enabled" }}
+{{- end }}
+- name: TALOS_SERVER_PROXY_DHCP_ENABLED
+  value: "true"
+- name: TALOS_SERVER_PROXY_DHCP_SERVER_IP
+  value: {{ required "server.proxyDHCP.serverIP is required" .Values.server.proxyDHCP.serverIP | quote }}
+- name: TALOS_SERVER_PROXY_DHCP_TFTP_SERVER
+  value: {{ required "server.proxyDHCP.tftpServer is required" .Values.server.proxyDHCP.tftpServer | quote }}
+{{- end }}
+{{- end }}
@@ -1,6 +1,11 @@
 package cmd
 
 import (
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
 	"github.com/lukaspj/go-fang"
 	"github.com/lukaspj/talos-cluster-operator/pkg/machineconfig"
 	"github.com/lukaspj/talos-cluster-operator/pkg/operator"
@@ -10,16 +15,43 @@ func OperatorConfig() (operator.Config, error) {
 	config, err := fang.New[operator.Config]().
 		WithDefault(operator.DefaultConfig()).
 		WithAutomaticEnv("TALOS_OPERATOR").
+		WithMappers(parseEnvValue).
 		Load()
 
 	return config, err
 }
 
+// ServerConfig loads the machine config server config. It has a prefix of its own, as the operator embedding the
+// server reads both from the same environment.
 func ServerConfig() (machineconfig.Config, error) {
 	config, err := fang.New[machineconfig.Config]().
 		WithDefault(machineconfig.DefaultConfig()).
-		WithAutomaticEnv("TALOS_OPERATOR").
+		WithAutomaticEnv("TALOS_SERVER").
+		WithMappers(parseEnvValue).
 		Load()
 
 	return config, err
 }
+
+// parseEnvValue converts the string value of an environment variable into the type of the config field it is bound to.
+func parseEnvValue(from, to reflect.Type, data any) (any, error) {
+	value, ok := data.(string)
+	if from.Kind() != reflect.String || !ok || to.Kind() == reflect.String {
+		return data, nil
+	}
+
+	switch {
+	case to == reflect.TypeFor[time.Duration]():
+		return time.ParseDuration(value)
+	case to == reflect.TypeFor[[]string]():
+		return strings.Split(value, ","), nil
+	case to.Kind() == reflect.Bool:
+		return strconv.ParseBool(value)
+	case to.Kind() == reflect.Int:
+		return strconv.Atoi(value)
+	case to.Kind() == reflect.Float64:
+		return strconv.ParseFloat(value, 64)
+	}
+
+	return data, nil
+}
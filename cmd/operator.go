@@ -1,15 +1,27 @@
 package cmd
 
 import (
+	"context"
 	"log/slog"
 
 	"github.com/go-logr/logr"
 	"github.com/lukaspj/talos-cluster-operator/pkg/api/v1alpha1"
+	"github.com/lukaspj/talos-cluster-operator/pkg/imagefactory"
+	"github.com/lukaspj/talos-cluster-operator/pkg/machineconfig"
 	"github.com/lukaspj/talos-cluster-operator/pkg/operator"
+	"github.com/lukaspj/talos-cluster-operator/pkg/readyz"
+	"github.com/lukaspj/talos-cluster-operator/pkg/talosclient"
+	"github.com/lukaspj/talos-cluster-operator/pkg/tracing"
 	"github.com/spf13/cobra"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 )
 
 var operatorCmd = &cobra.Command{
@@ -27,12 +39,37 @@ var operatorCmd = &cobra.Command{
 		slog.SetLogLoggerLevel(slog.LevelInfo)
 		ctrl.SetLogger(logr.FromSlogHandler(slog.Default().Handler()))
 
+		ctx := ctrl.SetupSignalHandler()
+		shutdownTracing, err := tracing.Setup(ctx, "talos-cluster-operator", cfg.OTLPEndpoint, cfg.OTLPInsecure)
+		if err != nil {
+			slog.Error("unable to set up tracing", "error", err)
+			return err
+		}
+		defer shutdownTracing(context.Background())
+
 		scheme := runtime.NewScheme()
+		if err := clientgoscheme.AddToScheme(scheme); err != nil {
+			slog.Error("unable to add to scheme", "error", err)
+			return err
+		}
 		if err := v1alpha1.AddToScheme(scheme); err != nil {
 			slog.Error("unable to add to scheme", "error", err)
 			return err
 		}
 
+		cacheOpts := cache.Options{DefaultNamespaces: cfg.CacheNamespaces()}
+		var serverCfg machineconfig.Config
+		if cfg.ServerEnabled {
+			serverCfg, err = ServerConfig()
+			if err != nil {
+				slog.Error("unable to load server config", slog.String("error", err.Error()))
+				return err
+			}
+			slog.Info("server config loaded", slog.String("config", serverCfg.String()))
+			// The server shares the manager's cache, which also holds the Machines outside the operator's namespaces.
+			cacheOpts.ByObject = serverCfg.CacheByObject(cfg.Namespace)
+		}
+
 		mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 			Scheme:                  scheme,
 			HealthProbeBindAddress:  cfg.ProbeAddr,
@@ -41,16 +78,60 @@ var operatorCmd = &cobra.Command{
 			LeaderElectionID:        "election42.talos-cluster-operator.lukaspj.com",
 			LivenessEndpointName:    "/livez",
 			ReadinessEndpointName:   "/readyz",
+			Metrics: metricsserver.Options{
+				BindAddress: cfg.MetricsAddr,
+			},
+			Cache: cacheOpts,
+			// Secrets and the address claims of the config server are read from the API server, so the contents of
+			// every Secret in the cluster are not kept in memory.
+			Client: client.Options{
+				Cache: &client.CacheOptions{DisableFor: []client.Object{&corev1.Secret{}, &coordinationv1.Lease{}}},
+			},
 		})
 		if err != nil {
 			slog.Error("unable to start manager", "error", err)
 			return err
 		}
 
+		operator.RegisterMetrics(mgr.GetClient())
+
+		talosClients := talosclient.NewPool(cfg.TalosClientIdleTimeout)
+		if err = mgr.Add(talosClients); err != nil {
+			slog.Error("unable to add talos client pool", "error", err)
+			return err
+		}
+
+		readyzChecks := operator.ReadyzChecks(mgr.GetAPIReader(), mgr.GetCache(), talosClients, cfg)
+		if cfg.ServerEnabled {
+			srv, err := machineconfig.NewManagedServer(serverCfg, mgr, talosClients)
+			if err != nil {
+				slog.Error("unable to create machine config server", "error", err)
+				return err
+			}
+			if err = mgr.Add(srv); err != nil {
+				slog.Error("unable to add machine config server", "error", err)
+				return err
+			}
+			for name, check := range srv.ReadyzChecks() {
+				readyzChecks["machineconfig-"+name] = check
+			}
+		}
+
 		machineReconciler := &operator.TalosMachineReconciler{
 			Client:   mgr.GetClient(),
 			Scheme:   mgr.GetScheme(),
-			Recorder: mgr.GetEventRecorderFor("talos-machine-controller"),
+			Recorder: mgr.GetEventRecorderFor(operator.MachineControllerName),
+			Config:   cfg,
+			Talos: &operator.TalosMachineAPI{
+				Client: mgr.GetClient(),
+				Talos:  talosClients,
+				Config: cfg,
+			},
+			Workload: &operator.KubernetesWorkloadNodes{
+				Client: mgr.GetClient(),
+				Talos:  talosClients,
+				Config: cfg,
+			},
 		}
 
 		if err = machineReconciler.SetupWithManager(mgr); err != nil {
@@ -61,7 +142,10 @@ var operatorCmd = &cobra.Command{
 		clusterReconciler := &operator.TalosClusterReconciler{
 			Client:   mgr.GetClient(),
 			Scheme:   mgr.GetScheme(),
-			Recorder: mgr.GetEventRecorderFor("talos-cluster-controller"),
+			Recorder: mgr.GetEventRecorderFor(operator.ClusterControllerName),
+			Talos:    talosClients,
+			Factory:  imagefactory.NewClient(cfg.ImageFactoryURL),
+			Config:   cfg,
 		}
 
 		if err = clusterReconciler.SetupWithManager(mgr); err != nil {
@@ -73,13 +157,16 @@ var operatorCmd = &cobra.Command{
 			slog.Error("unable to set up health check", "error", err)
 			return err
 		}
-		if err = mgr.AddReadyzCheck("readyz", healthz.Ping); err != nil {
-			slog.Error("unable to set up ready check", "error", err)
-			return err
+		// The checks of the operator and the embedded server share the deadline of a probe.
+		for name, check := range readyz.Concurrent(readyzChecks) {
+			if err = mgr.AddReadyzCheck(name, check); err != nil {
+				slog.Error("unable to set up ready check", "check", name, "error", err)
+				return err
+			}
 		}
 
 		slog.Info("starting manager")
-		if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
+		if err := mgr.Start(ctx); err != nil {
 			slog.Error("problem running manager", "error", err)
 			return err
 		}
@@ -1,9 +1,11 @@
 package cmd
 
 import (
+	"context"
 	"log/slog"
 
 	"github.com/lukaspj/talos-cluster-operator/pkg/machineconfig"
+	"github.com/lukaspj/talos-cluster-operator/pkg/tracing"
 	"github.com/spf13/cobra"
 )
 
@@ -32,6 +34,13 @@ var machineconfigCmd = &cobra.Command{
 
 		slog.SetLogLoggerLevel(slog.LevelInfo)
 
+		shutdownTracing, err := tracing.Setup(cmd.Context(), "talos-machineconfig-server", cfg.OTLPEndpoint, cfg.OTLPInsecure)
+		if err != nil {
+			slog.Error("unable to set up tracing", "error", err)
+			return err
+		}
+		defer shutdownTracing(context.Background())
+
 		srv := machineconfig.NewServer(cfg)
 
 		return srv.Start(cmd.Context())
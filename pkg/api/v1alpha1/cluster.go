@@ -1,22 +1,127 @@
 package v1alpha1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 )
 
 type MachineSet struct {
-	Name     string               `json:"name"`
+	Name string `json:"name"`
+	// Selector selects the Machines of the set. An empty selector selects no Machines rather than all of them.
 	Selector metav1.LabelSelector `json:"selector"`
-	Config   string               `json:"config"`
+	// Config names the machine config patch the machines of the set request their config with. The config server
+	// renders the installer image of the set into those configs, so new machines install it right away.
+	Config string `json:"config"`
+
+	// Schematic customises the Talos image of the machines through the Image Factory. The machines are upgraded to
+	// the resulting installer image one at a time.
+	// +kubebuilder:validation:Optional
+	Schematic *Schematic `json:"schematic,omitempty"`
+	// TalosVersion is the version of the installer image. The operator's Talos version is used when unset.
+	// +kubebuilder:validation:Optional
+	TalosVersion string `json:"talosVersion,omitempty"`
+	// ConfigApplyMode re-applies the desired config to machines whose live config drifted. Drift is only reported
+	// when unset.
+	// +kubebuilder:validation:Optional
+	ConfigApplyMode ConfigApplyMode `json:"configApplyMode,omitempty"`
+}
+
+// ConfigApplyMode is the Talos apply mode used to re-apply a drifted machine config.
+// +kubebuilder:validation:Enum=auto;staged;no-reboot
+type ConfigApplyMode string
+
+const (
+	ConfigApplyModeAuto     ConfigApplyMode = "auto"
+	ConfigApplyModeStaged   ConfigApplyMode = "staged"
+	ConfigApplyModeNoReboot ConfigApplyMode = "no-reboot"
+)
+
+// Schematic is an Image Factory schematic.
+type Schematic struct {
+	// Extensions are official system extensions, e.g. siderolabs/iscsi-tools.
+	// +kubebuilder:validation:Optional
+	Extensions []string `json:"extensions,omitempty"`
+	// +kubebuilder:validation:Optional
+	ExtraKernelArgs []string `json:"extraKernelArgs,omitempty"`
+	// +kubebuilder:validation:Optional
+	Overlay *SchematicOverlay `json:"overlay,omitempty"`
+}
+
+type SchematicOverlay struct {
+	// Image is the overlay image, e.g. siderolabs/sbc-raspberrypi.
+	Image string `json:"image"`
+	// Name is the overlay within the image, e.g. rpi_generic.
+	Name string `json:"name"`
 }
 
 type ClusterSpec struct {
 	Nodes      MachineSet   `json:"nodes"`
 	WorkerSets []MachineSet `json:"workerSets"`
+
+	// MachineNamespace is the namespace of the Machines selected by the MachineSets, the Cluster's own namespace
+	// when unset. Set it to "*" to select Machines of every namespace watched by the operator.
+	// +kubebuilder:validation:Optional
+	MachineNamespace string `json:"machineNamespace,omitempty"`
+
+	// TalosConfigRef selects the talosconfig used to talk to the cluster from a Secret in the Cluster's namespace.
+	// The operator-wide talosconfig is used when unset.
+	// +kubebuilder:validation:Optional
+	TalosConfigRef *corev1.SecretKeySelector `json:"talosConfigRef,omitempty"`
+}
+
+const (
+	// ClusterCredentialsCondition reports whether the talosconfig of the cluster could be loaded.
+	ClusterCredentialsCondition = "CredentialsAvailable"
+	// ClusterHealthyCondition reports the outcome of the latest Talos cluster health check.
+	ClusterHealthyCondition = "Healthy"
+	// ClusterSchematicsCondition reports whether the schematics of every MachineSet are registered.
+	ClusterSchematicsCondition = "SchematicsReady"
+)
+
+// AllMachineNamespaces is the MachineNamespace of Clusters selecting Machines of every namespace.
+const AllMachineNamespaces = "*"
+
+// MachinesNamespace returns the namespace the Cluster selects Machines from, or "" for every namespace.
+func (in *Cluster) MachinesNamespace() string {
+	switch in.Spec.MachineNamespace {
+	case "":
+		return in.Namespace
+	case AllMachineNamespaces:
+		return ""
+	default:
+		return in.Spec.MachineNamespace
+	}
+}
+
+// MachineSets returns the control plane set followed by the worker sets.
+func (in *ClusterSpec) MachineSets() []MachineSet {
+	return append([]MachineSet{in.Nodes}, in.WorkerSets...)
+}
+
+// MachineSelector returns the selector of the Machines of the set. An empty selector matches nothing, a set left
+// unset must not claim every Machine of the namespace.
+func (in *MachineSet) MachineSelector() (labels.Selector, error) {
+	if len(in.Selector.MatchLabels) == 0 && len(in.Selector.MatchExpressions) == 0 {
+		return labels.Nothing(), nil
+	}
+
+	return metav1.LabelSelectorAsSelector(&in.Selector)
 }
 
 type ClusterStatus struct {
-	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// ObservedGeneration is the most recent generation observed by the controller.
+	ObservedGeneration int64              `json:"observedGeneration,omitempty"`
+	Conditions         []metav1.Condition `json:"conditions,omitempty"`
+
+	// MachineSets reports the installer image of every MachineSet with a schematic.
+	MachineSets []MachineSetStatus `json:"machineSets,omitempty"`
+}
+
+type MachineSetStatus struct {
+	Name           string `json:"name"`
+	SchematicID    string `json:"schematicID"`
+	InstallerImage string `json:"installerImage"`
 }
 
 // Cluster describes where to locate some node running Talos
@@ -38,6 +143,14 @@ type ClusterList struct {
 	Items           []Cluster `json:"items"`
 }
 
+func (in *Cluster) GetConditions() []metav1.Condition {
+	return in.Status.Conditions
+}
+
+func (in *Cluster) SetConditions(conditions []metav1.Condition) {
+	in.Status.Conditions = conditions
+}
+
 func init() {
 	SchemeBuilder.Register(&Cluster{}, &ClusterList{})
 }
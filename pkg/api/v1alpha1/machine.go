@@ -1,21 +1,186 @@
 package v1alpha1
 
 import (
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+// MachineDeletionPolicy decides what happens to the physical machine when its Machine is deleted.
+// +kubebuilder:validation:Enum=Retain;Reset
+type MachineDeletionPolicy string
+
+const (
+	// MachineDeletionPolicyRetain leaves the machine running whatever it is running.
+	MachineDeletionPolicyRetain MachineDeletionPolicy = "Retain"
+	// MachineDeletionPolicyReset resets the machine back into maintenance mode before the Machine is removed.
+	MachineDeletionPolicyReset MachineDeletionPolicy = "Reset"
+)
+
+// MachineWipeMode selects the disks wiped by a reset.
+// +kubebuilder:validation:Enum=All;SystemDisk;UserDisks
+type MachineWipeMode string
+
+const (
+	MachineWipeModeAll        MachineWipeMode = "All"
+	MachineWipeModeSystemDisk MachineWipeMode = "SystemDisk"
+	MachineWipeModeUserDisks  MachineWipeMode = "UserDisks"
+)
+
+// MachineFinalizer keeps a Machine, and thereby its IP, around until its deletion policy has been carried out.
+const MachineFinalizer = "talos-cluster-operator.lukaspj.com/machine"
+
+// MachineMaintenanceAnnotation takes a machine out of service like spec.maintenance, with the annotation value as the
+// reason. It suits tooling that may not edit the spec; shutting the machine down requires spec.maintenance.
+const MachineMaintenanceAnnotation = "talos-cluster-operator.lukaspj.com/maintenance"
+
+// MachineBMC describes how to reach the baseboard management controller of a machine.
+type MachineBMC struct {
+	// Address of the BMC, e.g. https://10.0.1.10 for Redfish or 10.0.1.10:623 for IPMI.
+	Address string `json:"address"`
+
+	// +kubebuilder:validation:Enum=redfish;ipmi
+	// +kubebuilder:default:=redfish
+	// +kubebuilder:validation:Optional
+	Driver string `json:"driver,omitempty"`
+
+	// CredentialsRef references a Secret in the Machine's namespace with the keys username and password.
+	CredentialsRef corev1.LocalObjectReference `json:"credentialsRef"`
+
+	// SystemID selects the Redfish system, the first system of the BMC is used when unset.
+	// +kubebuilder:validation:Optional
+	SystemID string `json:"systemID,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	InsecureSkipVerify bool `json:"insecureSkipVerify,omitempty"`
+}
+
 type MachineSpec struct {
 	IP string `json:"ip"`
 
+	// MAC is the hardware address the machine network boots from. It lets the boot service recognise registered
+	// machines.
+	// +kubebuilder:validation:Optional
+	MAC string `json:"mac,omitempty"`
+
 	// +kubebuilder:default:=50000
 	// +kubebuilder:validation:Optional
 	Port int `json:"port"`
+
+	// +kubebuilder:default:=Retain
+	// +kubebuilder:validation:Optional
+	DeletionPolicy MachineDeletionPolicy `json:"deletionPolicy,omitempty"`
+
+	// WipeMode selects the disks wiped when the machine is reset on deletion.
+	// +kubebuilder:default:=All
+	// +kubebuilder:validation:Optional
+	WipeMode MachineWipeMode `json:"wipeMode,omitempty"`
+
+	// BMC enables power management of the machine. Machines claimed by a Cluster are powered on, machines that
+	// stay unreachable are power cycled and released machines are powered off.
+	// +kubebuilder:validation:Optional
+	BMC *MachineBMC `json:"bmc,omitempty"`
+
+	// ConfigSecretRef names a Secret in the Machine's namespace holding the desired machine config under the key
+	// "config". The live config of the machine is compared against it periodically. Configs rendered by the config
+	// server are kept in the operator's namespace instead, see DesiredConfigSecretName.
+	// +kubebuilder:validation:Optional
+	ConfigSecretRef *corev1.LocalObjectReference `json:"configSecretRef,omitempty"`
+
+	// Maintenance takes the machine out of service. Its Kubernetes node in the workload cluster is cordoned and
+	// drained, it is not claimed by Clusters it is not yet part of, and it is restored once Maintenance is cleared.
+	// The maintenance annotation has the same effect.
+	// +kubebuilder:validation:Optional
+	Maintenance *MachineMaintenance `json:"maintenance,omitempty"`
+}
+
+type MachineMaintenance struct {
+	// Reason is a free-form note on why the machine is in maintenance.
+	// +kubebuilder:validation:Optional
+	Reason string `json:"reason,omitempty"`
+	// Shutdown shuts the machine down through Talos once it is drained.
+	// +kubebuilder:validation:Optional
+	Shutdown bool `json:"shutdown,omitempty"`
 }
 
+// RegistrationPending reports whether the machine has not reported in since the config server registered it.
+func (in *Machine) RegistrationPending() bool {
+	return in.Status.Phase == MachinePhasePending
+}
+
+// InMaintenance reports whether the machine is taken out of service, through its spec or the maintenance annotation.
+func (in *Machine) InMaintenance() bool {
+	_, annotated := in.Annotations[MachineMaintenanceAnnotation]
+	return in.Spec.Maintenance != nil || annotated
+}
+
+// DesiredConfigSecretName is the name of the Secret, in the operator's namespace, the config server keeps the config
+// it rendered for the machine in. The config carries the secrets of the management cluster, which must not be
+// readable from the Machine's namespace.
+func (in *Machine) DesiredConfigSecretName() string {
+	return in.Namespace + "." + in.Name + "-config"
+}
+
+// IPClaimName is the name of the Lease, in the operator's namespace, the config server claims an address with before
+// assigning it to a Machine.
+func IPClaimName(ip string) string {
+	return "machine-ip-" + strings.NewReplacer(".", "-", ":", "-").Replace(ip)
+}
+
+const (
+	// MachineAvailableCondition reports whether the Talos API of the machine can be reached.
+	MachineAvailableCondition = "Available"
+	// MachineResetCondition tracks the reset of a deleted machine with the Reset deletion policy.
+	MachineResetCondition = "Reset"
+	// MachinePowerManagedCondition reports whether the BMC of the machine can be used.
+	MachinePowerManagedCondition = "PowerManaged"
+	// MachineConfigInSyncCondition reports whether the live machine config matches the desired one.
+	MachineConfigInSyncCondition = "ConfigInSync"
+	// MachineCordonedCondition reports whether the Kubernetes node of a machine in maintenance is cordoned.
+	MachineCordonedCondition = "Cordoned"
+	// MachineDrainedCondition reports whether the Kubernetes node of a machine in maintenance is drained.
+	MachineDrainedCondition = "Drained"
+	// MachineShutdownCondition reports whether a machine in maintenance was shut down.
+	MachineShutdownCondition = "Shutdown"
+)
+
 type MachineStatus struct {
-	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// ObservedGeneration is the most recent generation observed by the controller.
+	ObservedGeneration int64              `json:"observedGeneration,omitempty"`
+	Conditions         []metav1.Condition `json:"conditions,omitempty"`
+
+	// Cluster is the namespace/name of the Cluster whose MachineSets select the machine.
+	Cluster string `json:"cluster,omitempty"`
+	// LastPowerCycleTime is when the operator last hard rebooted the machine through its BMC.
+	LastPowerCycleTime *metav1.Time `json:"lastPowerCycleTime,omitempty"`
+	// InstallerImage is the installer image the machine was last upgraded to by the operator.
+	InstallerImage string `json:"installerImage,omitempty"`
+	// Upgrade is the upgrade the operator issued to the machine and waits on. It completes once the machine booted
+	// again on the version of the image.
+	Upgrade *MachineUpgrade `json:"upgrade,omitempty"`
+	// Phase tracks the registration of machines registered by the config server. Machines registered before phases
+	// were introduced have none and count as registered.
+	Phase MachinePhase `json:"phase,omitempty"`
 }
 
+type MachineUpgrade struct {
+	Image     string      `json:"image"`
+	StartTime metav1.Time `json:"startTime"`
+}
+
+// MachinePhase is the registration phase of a Machine.
+// +kubebuilder:validation:Enum=Pending;Registered
+type MachinePhase string
+
+const (
+	// MachinePhasePending machines were handed a config by the config server but have not reported in yet. They
+	// are deleted when they do not report in within the registration timeout.
+	MachinePhasePending MachinePhase = "Pending"
+	// MachinePhaseRegistered machines were reachable on their assigned address at least once.
+	MachinePhaseRegistered MachinePhase = "Registered"
+)
+
 // Machine describes where to locate some node running Talos
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
@@ -35,6 +200,14 @@ type MachineList struct {
 	Items           []Machine `json:"items"`
 }
 
+func (in *Machine) GetConditions() []metav1.Condition {
+	return in.Status.Conditions
+}
+
+func (in *Machine) SetConditions(conditions []metav1.Condition) {
+	in.Status.Conditions = conditions
+}
+
 func init() {
 	SchemeBuilder.Register(&Machine{}, &MachineList{})
 }
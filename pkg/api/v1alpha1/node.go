@@ -8,7 +8,9 @@ type NodeSpec struct {
 }
 
 type NodeStatus struct {
-	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// ObservedGeneration is the most recent generation observed by the controller.
+	ObservedGeneration int64              `json:"observedGeneration,omitempty"`
+	Conditions         []metav1.Condition `json:"conditions,omitempty"`
 }
 
 // Node describes where to locate some node running Talos
@@ -22,12 +24,20 @@ type Node struct {
 	Status NodeStatus `json:"status,omitempty"`
 }
 
-// NodeList contains a list of Machines
+// NodeList contains a list of Nodes
 // +kubebuilder:object:root=true
 type NodeList struct {
 	metav1.TypeMeta `json:",inline"`
 	metav1.ListMeta `json:"metadata,omitempty"`
-	Items           []Cluster `json:"items"`
+	Items           []Node `json:"items"`
+}
+
+func (in *Node) GetConditions() []metav1.Condition {
+	return in.Status.Conditions
+}
+
+func (in *Node) SetConditions(conditions []metav1.Condition) {
+	in.Status.Conditions = conditions
 }
 
 func init() {
@@ -0,0 +1,53 @@
+// Package bmc controls the power of machines through their baseboard management controller.
+package bmc
+
+import (
+	"context"
+	"fmt"
+)
+
+type PowerState string
+
+const (
+	PowerOn      PowerState = "On"
+	PowerOff     PowerState = "Off"
+	PowerUnknown PowerState = "Unknown"
+)
+
+const (
+	DriverRedfish = "redfish"
+	DriverIPMI    = "ipmi"
+)
+
+// Driver powers a single machine on and off.
+type Driver interface {
+	PowerState(ctx context.Context) (PowerState, error)
+	PowerOn(ctx context.Context) error
+	PowerOff(ctx context.Context) error
+	// Reboot hard resets the machine without waiting for the operating system to shut down.
+	Reboot(ctx context.Context) error
+}
+
+type Credentials struct {
+	Username string
+	Password string
+}
+
+type Options struct {
+	// SystemID selects the Redfish system to control. The first system is used when empty.
+	SystemID string
+	// InsecureSkipVerify disables verification of the BMC's TLS certificate.
+	InsecureSkipVerify bool
+}
+
+// New returns the driver with the given name for the BMC at address.
+func New(driver, address string, credentials Credentials, opts Options) (Driver, error) {
+	switch driver {
+	case DriverRedfish, "":
+		return NewRedfish(address, credentials, opts), nil
+	case DriverIPMI:
+		return NewIPMI(address, credentials), nil
+	default:
+		return nil, fmt.Errorf("unknown bmc driver %q", driver)
+	}
+}
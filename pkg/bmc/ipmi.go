@@ -0,0 +1,76 @@
+package bmc
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// IPMI controls the chassis power through ipmitool over the lanplus interface. ipmitool must be on the PATH, the
+// operator image ships it.
+type IPMI struct {
+	host        string
+	port        string
+	credentials Credentials
+}
+
+func NewIPMI(address string, credentials Credentials) *IPMI {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		host, port = address, "623"
+	}
+
+	return &IPMI{host: host, port: port, credentials: credentials}
+}
+
+func (i *IPMI) PowerState(ctx context.Context) (PowerState, error) {
+	out, err := i.run(ctx, "chassis", "power", "status")
+	if err != nil {
+		return PowerUnknown, err
+	}
+
+	switch {
+	case strings.HasSuffix(out, "is on"):
+		return PowerOn, nil
+	case strings.HasSuffix(out, "is off"):
+		return PowerOff, nil
+	default:
+		return PowerUnknown, nil
+	}
+}
+
+func (i *IPMI) PowerOn(ctx context.Context) error {
+	_, err := i.run(ctx, "chassis", "power", "on")
+	return err
+}
+
+func (i *IPMI) PowerOff(ctx context.Context) error {
+	_, err := i.run(ctx, "chassis", "power", "off")
+	return err
+}
+
+func (i *IPMI) Reboot(ctx context.Context) error {
+	_, err := i.run(ctx, "chassis", "power", "reset")
+	return err
+}
+
+// run invokes ipmitool, passing the password through the environment so it does not show up in the process list.
+func (i *IPMI) run(ctx context.Context, args ...string) (string, error) {
+	args = append([]string{"-I", "lanplus", "-H", i.host, "-p", i.port, "-U", i.credentials.Username, "-E"}, args...)
+
+	cmd := exec.CommandContext(ctx, "ipmitool", args...)
+	cmd.Env = append(os.Environ(), "IPMI_PASSWORD="+i.credentials.Password)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("ipmitool %s: %w: %s", strings.Join(args[len(args)-3:], " "), err, strings.TrimSpace(stderr.String()))
+	}
+
+	return strings.TrimSpace(stdout.String()), nil
+}
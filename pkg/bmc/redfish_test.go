@@ -0,0 +1,58 @@
+package bmc
+
+import (
+	"context"
+	"testing"
+
+	"github.com/lukaspj/talos-cluster-operator/pkg/bmc/redfishmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedfish(t *testing.T) {
+	ctx := context.Background()
+
+	srv := redfishmock.New("admin", "secret")
+	t.Cleanup(srv.Close)
+
+	driver, err := New(DriverRedfish, srv.URL, Credentials{Username: "admin", Password: "secret"}, Options{InsecureSkipVerify: true})
+	require.NoError(t, err)
+
+	state, err := driver.PowerState(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, PowerOff, state)
+
+	require.NoError(t, driver.PowerOn(ctx))
+	state, err = driver.PowerState(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, PowerOn, state)
+
+	require.NoError(t, driver.Reboot(ctx))
+	require.NoError(t, driver.PowerOff(ctx))
+	assert.Equal(t, []string{"On", "ForceRestart", "ForceOff"}, srv.Resets())
+	assert.Equal(t, "Off", srv.PowerState())
+
+	t.Run("wrong credentials", func(t *testing.T) {
+		driver := NewRedfish(srv.URL, Credentials{Username: "admin", Password: "wrong"}, Options{InsecureSkipVerify: true})
+
+		_, err := driver.PowerState(ctx)
+		assert.ErrorContains(t, err, "401")
+	})
+
+	t.Run("explicit system id", func(t *testing.T) {
+		driver := NewRedfish(srv.URL, Credentials{Username: "admin", Password: "secret"}, Options{SystemID: "1", InsecureSkipVerify: true})
+
+		state, err := driver.PowerState(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, PowerOff, state)
+	})
+}
+
+func TestNewRedfish_sharesClient(t *testing.T) {
+	a := NewRedfish("10.0.0.1", Credentials{}, Options{})
+	b := NewRedfish("10.0.0.2", Credentials{}, Options{})
+	insecure := NewRedfish("10.0.0.1", Credentials{}, Options{InsecureSkipVerify: true})
+
+	assert.Same(t, a.client, b.client, "drivers are created on every reconcile and must not leak connections")
+	assert.NotSame(t, a.client, insecure.client)
+}
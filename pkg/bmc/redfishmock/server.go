@@ -0,0 +1,121 @@
+// Package redfishmock provides an in-memory Redfish service with a single ComputerSystem for tests.
+package redfishmock
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+)
+
+const SystemPath = "/redfish/v1/Systems/1"
+
+type Server struct {
+	*httptest.Server
+
+	username string
+	password string
+
+	mu         sync.Mutex
+	powerState string
+	resets     []string
+}
+
+// New starts a TLS Redfish service accepting the given basic auth credentials. The system starts powered off.
+func New(username, password string) *Server {
+	s := &Server{
+		username:   username,
+		password:   password,
+		powerState: "Off",
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /redfish/v1/Systems", s.systems)
+	mux.HandleFunc("GET "+SystemPath, s.system)
+	mux.HandleFunc("POST "+SystemPath+"/Actions/ComputerSystem.Reset", s.reset)
+
+	s.Server = httptest.NewTLSServer(s.authenticate(mux))
+
+	return s
+}
+
+// PowerState returns the current Redfish power state of the system.
+func (s *Server) PowerState() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.powerState
+}
+
+func (s *Server) SetPowerState(state string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.powerState = state
+}
+
+// Resets returns the ResetType of every reset action received so far.
+func (s *Server) Resets() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string(nil), s.resets...)
+}
+
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, password, ok := r.BasicAuth()
+		if !ok || username != s.username || password != s.password {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) systems(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, map[string]any{
+		"Members": []map[string]string{{"@odata.id": SystemPath}},
+	})
+}
+
+func (s *Server) system(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, map[string]any{
+		"@odata.id":  SystemPath,
+		"Id":         "1",
+		"PowerState": s.PowerState(),
+	})
+}
+
+func (s *Server) reset(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		ResetType string `json:"ResetType"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch body.ResetType {
+	case "On", "ForceOn":
+		s.powerState = "On"
+	case "ForceOff", "GracefulShutdown":
+		s.powerState = "Off"
+	case "ForceRestart", "GracefulRestart", "PowerCycle":
+		s.powerState = "On"
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	s.resets = append(s.resets, body.ResetType)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
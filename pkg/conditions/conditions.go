@@ -0,0 +1,129 @@
+// Package conditions contains helpers for maintaining the status conditions of the operator's resources.
+package conditions
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// Ready is the summary condition set on every resource, see SetSummary.
+	Ready = "Ready"
+
+	ReasonReady        = "Ready"
+	ReasonChecksFailed = "ChecksFailed"
+)
+
+type Getter interface {
+	GetConditions() []metav1.Condition
+}
+
+type Setter interface {
+	Getter
+	GetGeneration() int64
+	SetConditions(conditions []metav1.Condition)
+}
+
+// Get returns the condition of the given type, or nil if it has not been set.
+func Get(obj Getter, conditionType string) *metav1.Condition {
+	return meta.FindStatusCondition(obj.GetConditions(), conditionType)
+}
+
+func IsTrue(obj Getter, conditionType string) bool {
+	return meta.IsStatusConditionTrue(obj.GetConditions(), conditionType)
+}
+
+func IsFalse(obj Getter, conditionType string) bool {
+	return meta.IsStatusConditionFalse(obj.GetConditions(), conditionType)
+}
+
+// Set adds or updates the given condition on obj. The transition time is only bumped when the status changes
+// and the observed generation is always taken from obj. The conditions are kept sorted by type, with Ready
+// first, so that repeated reconciles yield identical status documents. Set reports whether anything changed.
+func Set(obj Setter, condition metav1.Condition) bool {
+	conditions := obj.GetConditions()
+	condition.ObservedGeneration = obj.GetGeneration()
+
+	changed := meta.SetStatusCondition(&conditions, condition)
+	slices.SortStableFunc(conditions, compare)
+	obj.SetConditions(conditions)
+
+	return changed
+}
+
+func MarkTrue(obj Setter, conditionType, reason, message string) bool {
+	return Set(obj, metav1.Condition{
+		Type:    conditionType,
+		Status:  metav1.ConditionTrue,
+		Reason:  reason,
+		Message: message,
+	})
+}
+
+func MarkFalse(obj Setter, conditionType, reason, message string) bool {
+	return Set(obj, metav1.Condition{
+		Type:    conditionType,
+		Status:  metav1.ConditionFalse,
+		Reason:  reason,
+		Message: message,
+	})
+}
+
+func MarkUnknown(obj Setter, conditionType, reason, message string) bool {
+	return Set(obj, metav1.Condition{
+		Type:    conditionType,
+		Status:  metav1.ConditionUnknown,
+		Reason:  reason,
+		Message: message,
+	})
+}
+
+// Delete removes the condition of the given type from obj.
+func Delete(obj Setter, conditionType string) bool {
+	conditions := obj.GetConditions()
+	changed := meta.RemoveStatusCondition(&conditions, conditionType)
+	obj.SetConditions(conditions)
+
+	return changed
+}
+
+// SetSummary computes the Ready condition from the dependent conditions. Ready is True only when every dependent
+// condition is True; a dependent that has not been set yet counts as Unknown.
+func SetSummary(obj Setter, dependents ...string) bool {
+	var failed, unknown []string
+	for _, dependent := range dependents {
+		condition := Get(obj, dependent)
+		switch {
+		case condition == nil || condition.Status == metav1.ConditionUnknown:
+			unknown = append(unknown, dependent)
+		case condition.Status == metav1.ConditionFalse:
+			failed = append(failed, dependent)
+		}
+	}
+
+	switch {
+	case len(failed) > 0:
+		return MarkFalse(obj, Ready, ReasonChecksFailed, fmt.Sprintf("One or more checks failed: %s", strings.Join(failed, ", ")))
+	case len(unknown) > 0:
+		return MarkUnknown(obj, Ready, ReasonChecksFailed, fmt.Sprintf("Waiting for checks: %s", strings.Join(unknown, ", ")))
+	default:
+		return MarkTrue(obj, Ready, ReasonReady, "All checks passed")
+	}
+}
+
+func compare(a, b metav1.Condition) int {
+	switch {
+	case a.Type == b.Type:
+		return 0
+	case a.Type == Ready:
+		return -1
+	case b.Type == Ready:
+		return 1
+	default:
+		return strings.Compare(a.Type, b.Type)
+	}
+}
@@ -0,0 +1,109 @@
+package conditions
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lukaspj/talos-cluster-operator/pkg/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSet(t *testing.T) {
+	machine := &v1alpha1.Machine{ObjectMeta: metav1.ObjectMeta{Generation: 3}}
+
+	t.Run("new condition gets generation and transition time", func(t *testing.T) {
+		assert.True(t, MarkFalse(machine, "Available", "ConnectivityTestFailed", "dial failed"))
+
+		c := Get(machine, "Available")
+		require.NotNil(t, c)
+		assert.Equal(t, metav1.ConditionFalse, c.Status)
+		assert.EqualValues(t, 3, c.ObservedGeneration)
+		assert.False(t, c.LastTransitionTime.IsZero())
+	})
+
+	t.Run("same status keeps transition time", func(t *testing.T) {
+		past := metav1.NewTime(time.Now().Add(-time.Hour).Truncate(time.Second))
+		Get(machine, "Available").LastTransitionTime = past
+		machine.Generation = 4
+
+		MarkFalse(machine, "Available", "ConnectivityTestFailed", "dial failed again")
+
+		c := Get(machine, "Available")
+		assert.Equal(t, past, c.LastTransitionTime)
+		assert.EqualValues(t, 4, c.ObservedGeneration)
+		assert.Equal(t, "dial failed again", c.Message)
+	})
+
+	t.Run("status change bumps transition time", func(t *testing.T) {
+		past := Get(machine, "Available").LastTransitionTime
+
+		MarkTrue(machine, "Available", "ConnectivityTestSucceeded", "ok")
+
+		assert.True(t, Get(machine, "Available").LastTransitionTime.After(past.Time))
+	})
+
+	t.Run("unchanged condition reports no change", func(t *testing.T) {
+		assert.False(t, MarkTrue(machine, "Available", "ConnectivityTestSucceeded", "ok"))
+	})
+}
+
+func TestSetOrdering(t *testing.T) {
+	machine := &v1alpha1.Machine{}
+
+	MarkTrue(machine, "Zeta", "Ok", "")
+	MarkTrue(machine, "Alpha", "Ok", "")
+	SetSummary(machine, "Zeta", "Alpha")
+	MarkTrue(machine, "Beta", "Ok", "")
+
+	var types []string
+	for _, c := range machine.Status.Conditions {
+		types = append(types, c.Type)
+	}
+	assert.Equal(t, []string{Ready, "Alpha", "Beta", "Zeta"}, types)
+}
+
+func TestSetSummary(t *testing.T) {
+	tests := []struct {
+		name       string
+		conditions map[string]metav1.ConditionStatus
+		expected   metav1.ConditionStatus
+	}{
+		{
+			name:       "all dependents true",
+			conditions: map[string]metav1.ConditionStatus{"A": metav1.ConditionTrue, "B": metav1.ConditionTrue},
+			expected:   metav1.ConditionTrue,
+		},
+		{
+			name:       "one dependent false",
+			conditions: map[string]metav1.ConditionStatus{"A": metav1.ConditionTrue, "B": metav1.ConditionFalse},
+			expected:   metav1.ConditionFalse,
+		},
+		{
+			name:       "missing dependent",
+			conditions: map[string]metav1.ConditionStatus{"A": metav1.ConditionTrue},
+			expected:   metav1.ConditionUnknown,
+		},
+		{
+			name:       "false wins over unknown",
+			conditions: map[string]metav1.ConditionStatus{"B": metav1.ConditionFalse},
+			expected:   metav1.ConditionFalse,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			machine := &v1alpha1.Machine{}
+			for conditionType, status := range tt.conditions {
+				Set(machine, metav1.Condition{Type: conditionType, Status: status, Reason: "Test"})
+			}
+
+			SetSummary(machine, "A", "B")
+
+			c := Get(machine, Ready)
+			require.NotNil(t, c)
+			assert.Equal(t, tt.expected, c.Status)
+		})
+	}
+}
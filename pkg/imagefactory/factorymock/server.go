@@ -0,0 +1,68 @@
+// Package factorymock provides a local stand-in for the Image Factory schematics API.
+package factorymock
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+)
+
+type Server struct {
+	*httptest.Server
+
+	mu         sync.Mutex
+	schematics map[string][]byte
+	requests   int
+}
+
+// New starts a factory which, like the real one, derives the schematic ID from a hash of the schematic.
+func New() *Server {
+	s := &Server{schematics: map[string][]byte{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /schematics", s.create)
+	s.Server = httptest.NewServer(mux)
+
+	return s
+}
+
+// Schematic returns the schematic registered with the ID.
+func (s *Server) Schematic(id string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	schematic, ok := s.schematics[id]
+	return schematic, ok
+}
+
+// Requests returns the number of schematics posted so far.
+func (s *Server) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.requests
+}
+
+func (s *Server) create(w http.ResponseWriter, req *http.Request) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sum := sha256.Sum256(body)
+	id := hex.EncodeToString(sum[:])
+
+	s.mu.Lock()
+	s.schematics[id] = body
+	s.requests++
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(map[string]string{"id": id})
+}
@@ -0,0 +1,110 @@
+// Package imagefactory registers schematics with a Talos Image Factory.
+package imagefactory
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	yaml "go.yaml.in/yaml/v4"
+)
+
+type Schematic struct {
+	Overlay       *Overlay      `yaml:"overlay,omitempty"`
+	Customization Customization `yaml:"customization,omitempty"`
+}
+
+type Overlay struct {
+	Image string `yaml:"image"`
+	Name  string `yaml:"name"`
+}
+
+type Customization struct {
+	ExtraKernelArgs  []string         `yaml:"extraKernelArgs,omitempty"`
+	SystemExtensions SystemExtensions `yaml:"systemExtensions,omitempty"`
+}
+
+type SystemExtensions struct {
+	OfficialExtensions []string `yaml:"officialExtensions,omitempty"`
+}
+
+// Client registers schematics, remembering the ID of every schematic it registered.
+type Client struct {
+	URL  string
+	HTTP *http.Client
+
+	mu  sync.Mutex
+	ids map[string]string
+}
+
+func NewClient(url string) *Client {
+	return &Client{
+		URL:  strings.TrimSuffix(url, "/"),
+		HTTP: http.DefaultClient,
+		ids:  map[string]string{},
+	}
+}
+
+// Register returns the ID of the schematic, registering it with the factory unless it was registered before.
+func (c *Client) Register(ctx context.Context, schematic Schematic) (string, error) {
+	body, err := yaml.Marshal(schematic)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(body)
+	key := hex.EncodeToString(sum[:])
+
+	c.mu.Lock()
+	id, ok := c.ids[key]
+	c.mu.Unlock()
+	if ok {
+		return id, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.URL+"/schematics", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/yaml")
+
+	res, err := c.HTTP.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusCreated {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return "", fmt.Errorf("image factory rejected schematic: %s: %s", res.Status, strings.TrimSpace(string(msg)))
+	}
+
+	var created struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&created); err != nil {
+		return "", fmt.Errorf("unable to decode image factory response: %w", err)
+	}
+	if created.ID == "" {
+		return "", fmt.Errorf("image factory returned no schematic id")
+	}
+
+	c.mu.Lock()
+	c.ids[key] = created.ID
+	c.mu.Unlock()
+
+	return created.ID, nil
+}
+
+// InstallerImage returns the installer image of a schematic served by the registry of an Image Factory, e.g.
+// factory.talos.dev.
+func InstallerImage(registry, id, version string) string {
+	return fmt.Sprintf("%s/installer/%s:%s", strings.TrimSuffix(registry, "/"), id, version)
+}
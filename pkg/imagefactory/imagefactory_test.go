@@ -0,0 +1,46 @@
+package imagefactory
+
+import (
+	"context"
+	"testing"
+
+	"github.com/lukaspj/talos-cluster-operator/pkg/imagefactory/factorymock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_Register(t *testing.T) {
+	ctx := context.Background()
+	factory := factorymock.New()
+	defer factory.Close()
+
+	c := NewClient(factory.URL)
+	schematic := Schematic{
+		Customization: Customization{
+			ExtraKernelArgs:  []string{"net.ifnames=0"},
+			SystemExtensions: SystemExtensions{OfficialExtensions: []string{"siderolabs/iscsi-tools"}},
+		},
+	}
+
+	id, err := c.Register(ctx, schematic)
+	require.NoError(t, err)
+	assert.Len(t, id, 64)
+
+	registered, ok := factory.Schematic(id)
+	require.True(t, ok)
+	assert.Equal(t, "customization:\n    extraKernelArgs:\n        - net.ifnames=0\n    systemExtensions:\n        officialExtensions:\n            - siderolabs/iscsi-tools\n", string(registered))
+
+	again, err := c.Register(ctx, schematic)
+	require.NoError(t, err)
+	assert.Equal(t, id, again)
+	assert.Equal(t, 1, factory.Requests())
+
+	schematic.Overlay = &Overlay{Image: "siderolabs/sbc-raspberrypi", Name: "rpi_generic"}
+	other, err := c.Register(ctx, schematic)
+	require.NoError(t, err)
+	assert.NotEqual(t, id, other)
+}
+
+func TestInstallerImage(t *testing.T) {
+	assert.Equal(t, "factory.talos.dev/installer/abc:v1.11.3", InstallerImage("factory.talos.dev/", "abc", "v1.11.3"))
+}
@@ -0,0 +1,138 @@
+package machineconfig
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/lukaspj/talos-cluster-operator/pkg/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// reservationTTL is how long a handed out name and address are remembered, well beyond the time it takes the
+// informer cache to show the Machine created for them.
+const reservationTTL = 5 * time.Minute
+
+// allocator hands out machine names and addresses. Machines may be read from an informer cache which lags behind
+// the Machines this server created, so handed out names and addresses are remembered until the cache caught up.
+type allocator struct {
+	mu    sync.Mutex
+	ips   map[string]time.Time
+	names map[types.NamespacedName]time.Time
+}
+
+func newAllocator() *allocator {
+	return &allocator{
+		ips:   map[string]time.Time{},
+		names: map[types.NamespacedName]time.Time{},
+	}
+}
+
+// allocate picks the first free address of the CIDR, when set, and a free name in the namespace, and reserves
+// both. Machines of every namespace share the machine CIDR, so addresses are allocated cluster-wide. The network and
+// broadcast addresses of the machine subnet and the gateway are never handed out.
+func (a *allocator) allocate(machines []v1alpha1.Machine, machineCIDR string, subnetSize int, gateway, namespace string,
+	name func(taken func(name string) bool) (string, error)) (*net.IPNet, string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.expire(time.Now())
+
+	ips := map[string]bool{}
+	names := map[types.NamespacedName]bool{}
+	for _, m := range machines {
+		if ip := net.ParseIP(m.Spec.IP); ip != nil {
+			ips[ip.String()] = true
+		}
+		names[types.NamespacedName{Namespace: m.Namespace, Name: m.Name}] = true
+	}
+
+	machineIP := &net.IPNet{
+		Mask: net.CIDRMask(subnetSize, 32),
+	}
+	if machineCIDR != "" {
+		_, cidr, err := net.ParseCIDR(machineCIDR)
+		if err != nil {
+			return nil, "", err
+		}
+		if ip := net.ParseIP(gateway); ip != nil {
+			ips[ip.String()] = true
+		}
+		machineIP.IP = cidr.IP
+		for a.ipTaken(ips, machineIP.IP) || !hostAddress(machineIP.IP, machineIP.Mask) {
+			machineIP.IP = nextIP(machineIP.IP, 1)
+			if !cidr.Contains(machineIP.IP) {
+				return nil, "", unavailable(ErrIPPoolExhausted, time.Minute)
+			}
+		}
+	}
+
+	machineName, err := name(func(name string) bool {
+		key := types.NamespacedName{Namespace: namespace, Name: name}
+		_, reserved := a.names[key]
+		return names[key] || reserved
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	now := time.Now()
+	if machineIP.IP != nil {
+		a.ips[machineIP.IP.String()] = now
+	}
+	a.names[types.NamespacedName{Namespace: namespace, Name: machineName}] = now
+
+	return machineIP, machineName, nil
+}
+
+func (a *allocator) ipTaken(ips map[string]bool, ip net.IP) bool {
+	_, reserved := a.ips[ip.String()]
+	return ips[ip.String()] || reserved
+}
+
+// hostAddress reports whether the address is neither the network nor the broadcast address of its subnet. Point to
+// point subnets of one or two addresses have neither.
+func hostAddress(ip net.IP, mask net.IPMask) bool {
+	if ones, bits := mask.Size(); bits-ones < 2 {
+		return true
+	}
+
+	ip = ip.To4()
+	network := ip.Mask(mask)
+	broadcast := make(net.IP, len(network))
+	for i := range network {
+		broadcast[i] = network[i] | ^mask[i]
+	}
+
+	return !ip.Equal(network) && !ip.Equal(broadcast)
+}
+
+// release returns the name and address of a Machine which was rolled back.
+func (a *allocator) release(m *v1alpha1.Machine) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	delete(a.ips, m.Spec.IP)
+	delete(a.names, types.NamespacedName{Namespace: m.Namespace, Name: m.Name})
+}
+
+// releaseName returns the name of a Machine whose address turned out to be claimed elsewhere. The address stays
+// reserved.
+func (a *allocator) releaseName(m *v1alpha1.Machine) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	delete(a.names, types.NamespacedName{Namespace: m.Namespace, Name: m.Name})
+}
+
+func (a *allocator) expire(now time.Time) {
+	for ip, at := range a.ips {
+		if now.Sub(at) > reservationTTL {
+			delete(a.ips, ip)
+		}
+	}
+	for name, at := range a.names {
+		if now.Sub(at) > reservationTTL {
+			delete(a.names, name)
+		}
+	}
+}
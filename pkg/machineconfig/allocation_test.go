@@ -0,0 +1,84 @@
+package machineconfig
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/lukaspj/talos-cluster-operator/pkg/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestAllocator(t *testing.T) {
+	a := newAllocator()
+	sequential := func(taken func(string) bool) (string, error) {
+		return renderMachineName("node-{{ .Index }}", NameData{}, taken)
+	}
+	existing := []v1alpha1.Machine{{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-1", Namespace: "machines"},
+		Spec:       v1alpha1.MachineSpec{IP: "10.0.0.0"},
+	}}
+
+	// The second allocation sees the same stale list as the first, as a lagging cache would.
+	var machines []*v1alpha1.Machine
+	for i := range 2 {
+		ip, name, err := a.allocate(existing, "10.0.0.0/30", 24, "", "machines", sequential)
+		require.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf("10.0.0.%d/24", i+1), ip.String())
+		assert.Equal(t, fmt.Sprintf("node-%d", i+2), name)
+		machines = append(machines, &v1alpha1.Machine{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "machines"},
+			Spec:       v1alpha1.MachineSpec{IP: ip.IP.String()},
+		})
+	}
+
+	ip, name, err := a.allocate(existing, "10.0.0.0/30", 24, "", "other", sequential)
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.3/24", ip.String())
+	assert.Equal(t, "node-1", name)
+
+	_, _, err = a.allocate(existing, "10.0.0.0/30", 24, "", "machines", sequential)
+	assert.ErrorIs(t, err, ErrIPPoolExhausted)
+
+	a.release(machines[0])
+	ip, name, err = a.allocate(existing, "10.0.0.0/30", 24, "", "machines", sequential)
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.1/24", ip.String())
+	assert.Equal(t, "node-2", name)
+}
+
+func TestAllocator_reservedAddresses(t *testing.T) {
+	name := func(taken func(string) bool) (string, error) {
+		return renderMachineName("node-{{ .Index }}", NameData{}, taken)
+	}
+
+	tests := []struct {
+		name       string
+		cidr       string
+		subnetSize int
+		gateway    string
+		expected   []string
+	}{
+		{name: "network address and gateway", cidr: "10.0.0.0/30", subnetSize: 24, gateway: "10.0.0.1", expected: []string{"10.0.0.2", "10.0.0.3"}},
+		{name: "broadcast address", cidr: "10.0.0.252/30", subnetSize: 24, expected: []string{"10.0.0.252", "10.0.0.253", "10.0.0.254"}},
+		{name: "point to point subnet", cidr: "10.0.0.0/31", subnetSize: 31, expected: []string{"10.0.0.0", "10.0.0.1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newAllocator()
+			var ips []string
+			for {
+				ip, _, err := a.allocate(nil, tt.cidr, tt.subnetSize, tt.gateway, "machines", name)
+				if errors.Is(err, ErrIPPoolExhausted) {
+					break
+				}
+				require.NoError(t, err)
+				ips = append(ips, ip.IP.String())
+			}
+			assert.Equal(t, tt.expected, ips)
+		})
+	}
+}
@@ -0,0 +1,225 @@
+package machineconfig
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/lukaspj/talos-cluster-operator/pkg/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+// Audit sinks, see Config.AuditSinks.
+const (
+	AuditSinkEvent   = "event"
+	AuditSinkFile    = "file"
+	AuditSinkWebhook = "webhook"
+)
+
+// redacted replaces every secret of the config in an audit record.
+const redacted = "REDACTED"
+
+// auditQueueSize bounds the records waiting for the audit sinks.
+const auditQueueSize = 256
+
+// AuditRecord describes a machine config handed out by the server. It never holds secrets: the config is recorded
+// with its secrets redacted, next to the hash of the config as issued.
+type AuditRecord struct {
+	Time       time.Time `json:"time"`
+	RequestID  string    `json:"requestID"`
+	RemoteAddr string    `json:"remoteAddr"`
+
+	UUID     string `json:"uuid,omitempty"`
+	Serial   string `json:"serial,omitempty"`
+	MAC      string `json:"mac,omitempty"`
+	Hostname string `json:"hostname,omitempty"`
+
+	// Patches lists the patch ConfigMaps applied as namespace/name@resourceVersion.
+	Patches   []string `json:"patches"`
+	Namespace string   `json:"namespace"`
+	Machine   string   `json:"machine"`
+	IP        string   `json:"ip"`
+
+	// ConfigSHA256 is the hash of the config as written to the machine.
+	ConfigSHA256 string `json:"configSHA256"`
+	// SecretsVersion is the version of the management cluster's machine config the cluster secrets were copied from.
+	SecretsVersion string `json:"secretsVersion"`
+	// Config is the issued config with its secrets redacted.
+	Config string `json:"config,omitempty"`
+}
+
+// AuditSink stores audit records.
+type AuditSink interface {
+	Record(ctx context.Context, machine *v1alpha1.Machine, record AuditRecord) error
+}
+
+type auditEntry struct {
+	ctx     context.Context
+	machine *v1alpha1.Machine
+	record  AuditRecord
+}
+
+// auditQueue hands records to the sinks in the background, so a slow sink neither delays the end of the config
+// download nor keeps a render slot busy.
+type auditQueue struct {
+	sinks   []AuditSink
+	entries chan auditEntry
+}
+
+func newAuditQueue(sinks []AuditSink) *auditQueue {
+	return &auditQueue{sinks: sinks, entries: make(chan auditEntry, auditQueueSize)}
+}
+
+// enqueue detaches the record from the request, which is over before the sinks are done with it. Records are
+// dropped when the sinks fall too far behind.
+func (q *auditQueue) enqueue(ctx context.Context, m *v1alpha1.Machine, record AuditRecord) {
+	select {
+	case q.entries <- auditEntry{ctx: context.WithoutCancel(ctx), machine: m.DeepCopy(), record: record}:
+	default:
+		slog.Error("audit queue is full, dropping audit record", "machine", record.Machine, "requestID", record.RequestID)
+	}
+}
+
+// run records the queued entries until the context is cancelled, and then the ones still queued.
+func (q *auditQueue) run(ctx context.Context) {
+	for {
+		select {
+		case e := <-q.entries:
+			q.record(e)
+		case <-ctx.Done():
+			for {
+				select {
+				case e := <-q.entries:
+					q.record(e)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// record hands the entry to every sink. A failing sink is logged, the config was handed out by then.
+func (q *auditQueue) record(e auditEntry) {
+	for _, sink := range q.sinks {
+		if err := sink.Record(e.ctx, e.machine, e.record); err != nil {
+			slog.Error("unable to record audit record", "machine", e.record.Machine, "sink", fmt.Sprintf("%T", sink), "error", err)
+		}
+	}
+}
+
+// auditSinks creates the sinks named in the config.
+func (s *Server) auditSinks() ([]AuditSink, error) {
+	var sinks []AuditSink
+	for _, name := range s.Config.AuditSinks {
+		switch name {
+		case AuditSinkEvent:
+			sinks = append(sinks, NewEventAuditSink(s.kube, s.client.Scheme()))
+		case AuditSinkFile:
+			if s.Config.AuditFile == "" {
+				return nil, fmt.Errorf("audit sink %q requires an audit file", name)
+			}
+			sinks = append(sinks, &FileAuditSink{Path: s.Config.AuditFile})
+		case AuditSinkWebhook:
+			if s.Config.AuditWebhookURL == "" {
+				return nil, fmt.Errorf("audit sink %q requires a webhook URL", name)
+			}
+			sinks = append(sinks, &WebhookAuditSink{URL: s.Config.AuditWebhookURL, Client: &http.Client{Timeout: 10 * time.Second}})
+		case "":
+		default:
+			return nil, fmt.Errorf("unknown audit sink %q", name)
+		}
+	}
+
+	return sinks, nil
+}
+
+// EventAuditSink records an Event on the registered Machine. The redacted config is left out as events are kept
+// short.
+type EventAuditSink struct {
+	recorder record.EventRecorder
+}
+
+func NewEventAuditSink(kube kubernetes.Interface, scheme *runtime.Scheme) *EventAuditSink {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: kube.CoreV1().Events("")})
+
+	return &EventAuditSink{recorder: broadcaster.NewRecorder(scheme, corev1.EventSource{Component: FieldOwner})}
+}
+
+func (e *EventAuditSink) Record(_ context.Context, machine *v1alpha1.Machine, r AuditRecord) error {
+	e.recorder.Eventf(machine, corev1.EventTypeNormal, "MachineConfigIssued",
+		"Issued machine config sha256:%s to %s (request %s, mac %q, uuid %q, serial %q) with IP %s from patches %v and secrets version %s",
+		r.ConfigSHA256, r.RemoteAddr, r.RequestID, r.MAC, r.UUID, r.Serial, r.IP, r.Patches, r.SecretsVersion)
+
+	return nil
+}
+
+// FileAuditSink appends every record as a line of JSON.
+type FileAuditSink struct {
+	Path string
+
+	mu sync.Mutex
+}
+
+func (f *FileAuditSink) Record(_ context.Context, _ *v1alpha1.Machine, r AuditRecord) error {
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	file, err := os.OpenFile(f.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// WebhookAuditSink posts every record as JSON.
+type WebhookAuditSink struct {
+	URL    string
+	Client *http.Client
+}
+
+func (h *WebhookAuditSink) Record(ctx context.Context, _ *v1alpha1.Machine, r AuditRecord) error {
+	body, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := h.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("audit webhook returned %s", res.Status)
+	}
+
+	return nil
+}
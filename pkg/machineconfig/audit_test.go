@@ -0,0 +1,110 @@
+package machineconfig
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lukaspj/talos-cluster-operator/pkg/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func auditRecord(machine string) AuditRecord {
+	return AuditRecord{
+		RequestID:    "req-1",
+		RemoteAddr:   "10.0.0.10",
+		MAC:          "52:54:00:12:34:56",
+		Patches:      []string{"default/default-machine-config@42"},
+		Namespace:    "machines",
+		Machine:      machine,
+		IP:           "10.0.1.1",
+		ConfigSHA256: "abc",
+	}
+}
+
+func TestFileAuditSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	sink := &FileAuditSink{Path: path}
+	machine := &v1alpha1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "node-a", Namespace: "machines"}}
+
+	require.NoError(t, sink.Record(context.Background(), machine, auditRecord("node-a")))
+	require.NoError(t, sink.Record(context.Background(), machine, auditRecord("node-b")))
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	var machines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r AuditRecord
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &r))
+		machines = append(machines, r.Machine)
+	}
+	assert.Equal(t, []string{"node-a", "node-b"}, machines)
+}
+
+func TestWebhookAuditSink(t *testing.T) {
+	var received AuditRecord
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, "application/json", req.Header.Get("Content-Type"))
+		assert.NoError(t, json.NewDecoder(req.Body).Decode(&received))
+		if received.Machine == "rejected" {
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	defer srv.Close()
+
+	sink := &WebhookAuditSink{URL: srv.URL, Client: srv.Client()}
+
+	require.NoError(t, sink.Record(context.Background(), nil, auditRecord("node-a")))
+	assert.Equal(t, auditRecord("node-a"), received)
+
+	assert.ErrorContains(t, sink.Record(context.Background(), nil, auditRecord("rejected")), "403")
+}
+
+func TestServer_AuditSinks(t *testing.T) {
+	conf := DefaultConfig()
+	conf.AuditSinks = []string{AuditSinkWebhook}
+	_, err := NewServer(conf).auditSinks()
+	assert.ErrorContains(t, err, "requires a webhook URL")
+
+	conf.AuditSinks = []string{"syslog"}
+	_, err = NewServer(conf).auditSinks()
+	assert.ErrorContains(t, err, "unknown audit sink")
+}
+
+// blockingAuditSink stands in for a slow webhook.
+type blockingAuditSink struct {
+	release  chan struct{}
+	recorded chan error
+}
+
+func (b *blockingAuditSink) Record(ctx context.Context, _ *v1alpha1.Machine, _ AuditRecord) error {
+	<-b.release
+	b.recorded <- ctx.Err()
+	return nil
+}
+
+func TestAuditQueue(t *testing.T) {
+	sink := &blockingAuditSink{release: make(chan struct{}), recorded: make(chan error, 1)}
+	q := newAuditQueue([]AuditSink{sink})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go q.run(ctx)
+
+	// The request is over, and its context cancelled, before the sink is done.
+	reqCtx, reqCancel := context.WithCancel(context.Background())
+	q.enqueue(reqCtx, &v1alpha1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "node-a", Namespace: "machines"}}, auditRecord("node-a"))
+	reqCancel()
+
+	close(sink.release)
+	assert.NoError(t, <-sink.recorded, "the record is detached from the request")
+}
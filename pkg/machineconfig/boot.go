@@ -0,0 +1,229 @@
+package machineconfig
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/lukaspj/talos-cluster-operator/pkg/api/v1alpha1"
+	"github.com/lukaspj/talos-cluster-operator/pkg/proxydhcp"
+)
+
+const (
+	bootKernel    = "vmlinuz"
+	bootInitramfs = "initramfs.xz"
+	// bootIPXE is loaded by UEFI HTTP boot clients, pointed at it by the proxy DHCP responder.
+	bootIPXE = "ipxe.efi"
+
+	defaultConfigName = "default-machine-config"
+)
+
+// chainScript is served to iPXE clients which do not know their boot script yet, typically through the embedded
+// script or DHCP filename. iPXE expands the ${...} settings before fetching the per MAC script.
+var chainScript = template.Must(template.New("chain").Parse(`#!ipxe
+chain --autofree {{ .BaseURL }}/boot/${net0/mac:hexhyp}/ipxe?arch=${buildarch}{{ range $k, $v := .Query }}&{{ $k }}={{ $v }}{{ end }}
+`))
+
+var talosScript = template.Must(template.New("talos").Parse(`#!ipxe
+echo Booting Talos on {{ .MAC }}{{ if .Machine }} ({{ .Machine }}){{ end }}
+kernel {{ .BaseURL }}/boot/assets/{{ .Arch }}/vmlinuz initrd=initramfs.xz {{ .KernelArgs }}{{ if .ConfigURL }} talos.config={{ .ConfigURL }}{{ end }}
+initrd --name initramfs.xz {{ .BaseURL }}/boot/assets/{{ .Arch }}/initramfs.xz
+boot
+`))
+
+var diskScript = template.Must(template.New("disk").Parse(`#!ipxe
+echo Booting {{ .Machine }} from its installed disk
+exit
+`))
+
+type bootScript struct {
+	BaseURL    string
+	MAC        string
+	Machine    string
+	Arch       string
+	KernelArgs string
+	ConfigURL  string
+	Query      map[string]string
+}
+
+func (s *Server) bootRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /boot/ipxe", s.BootChain)
+	mux.HandleFunc("GET /boot/{mac}/ipxe", s.BootScript)
+	mux.HandleFunc("GET /boot/assets/{arch}/{file}", s.BootAsset)
+}
+
+// BootChain returns an iPXE script chaining to the boot script of the MAC address iPXE booted from. The
+// configName and namespace query parameters are passed on.
+func (s *Server) BootChain(w http.ResponseWriter, req *http.Request) {
+	query := map[string]string{}
+	for _, key := range []string{"configName", "namespace"} {
+		if value := req.URL.Query().Get(key); value != "" {
+			query[key] = url.QueryEscape(value)
+		}
+	}
+
+	s.writeScript(w, req, chainScript, bootScript{BaseURL: s.bootBaseURL(req), Query: query})
+}
+
+// BootScript returns the iPXE script for a MAC address. Unknown machines boot Talos with a talos.config pointing at
+// NewMachineConfig so they register, machines being deleted boot Talos in maintenance mode and registered
+// machines boot their installed disk.
+func (s *Server) BootScript(w http.ResponseWriter, req *http.Request) {
+	hw, err := net.ParseMAC(req.PathValue("mac"))
+	if err != nil {
+		errorResponse(w, req, badRequest(err), "invalid mac address")
+		return
+	}
+	mac := hw.String()
+
+	arch, ok := talosArch(req.URL.Query().Get("arch"))
+	if !ok {
+		errorResponse(w, req, badRequest(nil), "unsupported architecture")
+		return
+	}
+
+	configName := req.URL.Query().Get("configName")
+	if configName == "" {
+		configName = defaultConfigName
+	}
+
+	configPath := "/machineconfig/new/" + url.PathEscape(configName)
+	if ns := req.URL.Query().Get("namespace"); ns != "" {
+		if !slices.Contains(s.Config.Namespaces, ns) {
+			errorResponse(w, req, notFound(nil), "unknown namespace")
+			return
+		}
+		configPath = "/namespaces/" + url.PathEscape(ns) + configPath
+	}
+
+	machine, err := s.machineByMAC(req.Context(), mac)
+	if err != nil {
+		errorResponse(w, req, err, "failed to list machines")
+		return
+	}
+
+	script := bootScript{
+		BaseURL:    s.bootBaseURL(req),
+		MAC:        mac,
+		Arch:       arch,
+		KernelArgs: strings.Join(s.Config.BootKernelArgs, " "),
+	}
+
+	switch {
+	case machine == nil:
+		slog.Info("booting unknown machine for registration", "mac", mac, "configName", configName)
+		// iPXE fills in ${uuid} and ${serial} from SMBIOS.
+		script.ConfigURL = fmt.Sprintf("%s%s?mac=%s&uuid=${uuid}&serial=${serial}", script.BaseURL, configPath, url.QueryEscape(mac))
+		s.writeScript(w, req, talosScript, script)
+
+	case !machine.DeletionTimestamp.IsZero():
+		slog.Info("booting deleted machine into maintenance mode", "mac", mac, "machine", machine.Name)
+		script.Machine = machine.Name
+		s.writeScript(w, req, talosScript, script)
+
+	default:
+		slog.Info("booting registered machine from disk", "mac", mac, "machine", machine.Name)
+		s.writeScript(w, req, diskScript, bootScript{Machine: machine.Name})
+	}
+}
+
+// BootAsset serves the Talos kernel and initramfs, and the iPXE binary, of an architecture from the image cache.
+func (s *Server) BootAsset(w http.ResponseWriter, req *http.Request) {
+	file := req.PathValue("file")
+	if file != bootKernel && file != bootInitramfs && file != bootIPXE {
+		errorResponse(w, req, notFound(nil), "unknown boot asset")
+		return
+	}
+
+	arch, ok := talosArch(req.PathValue("arch"))
+	if !ok {
+		errorResponse(w, req, notFound(nil), "unsupported architecture")
+		return
+	}
+
+	http.ServeFile(w, req, filepath.Join(s.Config.BootImageCache, arch, file))
+}
+
+func (s *Server) writeScript(w http.ResponseWriter, req *http.Request, script *template.Template, data bootScript) {
+	w.Header().Set("Content-Type", "text/plain")
+	if err := script.Execute(w, data); err != nil {
+		errorResponse(w, req, err, "failed to render boot script")
+	}
+}
+
+// proxyDHCP opens the proxy DHCP responder, which points PXE clients at the boot service and records them as boot
+// hints.
+func (s *Server) proxyDHCP() (*proxydhcp.Server, error) {
+	if !s.Config.BootEnabled {
+		return nil, errors.New("proxy dhcp points clients at the boot service, which is not enabled")
+	}
+
+	serverIP := net.ParseIP(s.Config.ProxyDHCPServerIP)
+	if serverIP == nil {
+		return nil, fmt.Errorf("invalid proxy dhcp server ip %q", s.Config.ProxyDHCPServerIP)
+	}
+	tftpServer := net.ParseIP(s.Config.ProxyDHCPTFTPServer)
+	if tftpServer == nil {
+		return nil, fmt.Errorf("invalid proxy dhcp tftp server %q", s.Config.ProxyDHCPTFTPServer)
+	}
+
+	conf := proxydhcp.Config{
+		ServerIP:   serverIP,
+		TFTPServer: tftpServer,
+		BootURL:    s.Config.BootBaseURL,
+	}
+	if conf.BootURL == "" {
+		conf.BootURL = fmt.Sprintf("http://%s", net.JoinHostPort(serverIP.String(), strconv.Itoa(s.Config.Port)))
+	}
+
+	return proxydhcp.Listen(conf, func(d proxydhcp.Discovery) {
+		s.hints.Record(newBootHint(d.MAC, d.UUID, d.Arch))
+	})
+}
+
+// bootBaseURL returns the URL machines reach the server on.
+func (s *Server) bootBaseURL(req *http.Request) string {
+	if s.Config.BootBaseURL != "" {
+		return strings.TrimSuffix(s.Config.BootBaseURL, "/")
+	}
+
+	return "http://" + req.Host
+}
+
+// machineByMAC returns the Machine registered with the MAC address, or nil if there is none.
+func (s *Server) machineByMAC(ctx context.Context, mac string) (*v1alpha1.Machine, error) {
+	var l v1alpha1.MachineList
+	if err := s.client.List(ctx, &l); err != nil {
+		return nil, err
+	}
+
+	for _, m := range l.Items {
+		if hw, err := net.ParseMAC(m.Spec.MAC); err == nil && hw.String() == mac {
+			return &m, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// talosArch maps an iPXE build architecture onto the architecture names of Talos release assets. An empty
+// architecture defaults to amd64.
+func talosArch(arch string) (string, bool) {
+	switch arch {
+	case "", "amd64", "x86_64":
+		return "amd64", true
+	case "arm64":
+		return "arm64", true
+	default:
+		return "", false
+	}
+}
@@ -0,0 +1,141 @@
+package machineconfig
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lukaspj/talos-cluster-operator/pkg/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newBootServer(t *testing.T, objs ...client.Object) *httptest.Server {
+	scheme := runtime.NewScheme()
+	require.NoError(t, v1alpha1.AddToScheme(scheme))
+
+	conf := DefaultConfig()
+	conf.BootEnabled = true
+	conf.BootBaseURL = "http://boot.example:4242/"
+	conf.BootImageCache = t.TempDir()
+	conf.BootKernelArgs = []string{"talos.platform=metal"}
+	conf.Namespaces = []string{"team-a"}
+
+	require.NoError(t, os.MkdirAll(filepath.Join(conf.BootImageCache, "amd64"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(conf.BootImageCache, "amd64", bootKernel), []byte("kernel"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(conf.BootImageCache, "amd64", bootIPXE), []byte("ipxe"), 0o644))
+
+	s := NewServer(conf)
+	s.client = fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build()
+
+	srv := httptest.NewServer(s.Routes())
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func get(t *testing.T, url string) (int, string) {
+	res, err := http.Get(url)
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+
+	return res.StatusCode, string(body)
+}
+
+func TestServer_BootScript(t *testing.T) {
+	deleting := metav1.NewTime(time.Now())
+	srv := newBootServer(t,
+		&v1alpha1.Machine{
+			ObjectMeta: metav1.ObjectMeta{Name: "registered", Namespace: "machines"},
+			Spec:       v1alpha1.MachineSpec{IP: "10.0.0.1", MAC: "AA:BB:CC:DD:EE:01"},
+		},
+		&v1alpha1.Machine{
+			ObjectMeta: metav1.ObjectMeta{Name: "deleting", Namespace: "machines", DeletionTimestamp: &deleting, Finalizers: []string{v1alpha1.MachineFinalizer}},
+			Spec:       v1alpha1.MachineSpec{IP: "10.0.0.2", MAC: "aa:bb:cc:dd:ee:02"},
+		},
+	)
+
+	t.Run("chain passes on the config name", func(t *testing.T) {
+		code, body := get(t, srv.URL+"/boot/ipxe?configName=workers")
+		assert.Equal(t, http.StatusOK, code)
+		assert.Contains(t, body, "chain --autofree http://boot.example:4242/boot/${net0/mac:hexhyp}/ipxe?arch=${buildarch}&configName=workers")
+	})
+
+	t.Run("unknown machine registers", func(t *testing.T) {
+		code, body := get(t, srv.URL+"/boot/aa-bb-cc-dd-ee-ff/ipxe?arch=x86_64&configName=workers&namespace=team-a")
+		assert.Equal(t, http.StatusOK, code)
+		assert.Contains(t, body, "kernel http://boot.example:4242/boot/assets/amd64/vmlinuz initrd=initramfs.xz talos.platform=metal "+
+			"talos.config=http://boot.example:4242/namespaces/team-a/machineconfig/new/workers?mac=aa%3Abb%3Acc%3Add%3Aee%3Aff&uuid=${uuid}&serial=${serial}")
+	})
+
+	t.Run("registered machine boots from disk", func(t *testing.T) {
+		code, body := get(t, srv.URL+"/boot/aa-bb-cc-dd-ee-01/ipxe")
+		assert.Equal(t, http.StatusOK, code)
+		assert.Contains(t, body, "exit")
+		assert.NotContains(t, body, "kernel")
+	})
+
+	t.Run("deleted machine boots maintenance mode", func(t *testing.T) {
+		code, body := get(t, srv.URL+"/boot/aa-bb-cc-dd-ee-02/ipxe")
+		assert.Equal(t, http.StatusOK, code)
+		assert.Contains(t, body, "kernel ")
+		assert.NotContains(t, body, "talos.config")
+	})
+
+	t.Run("unknown namespace", func(t *testing.T) {
+		code, _ := get(t, srv.URL+"/boot/aa-bb-cc-dd-ee-ff/ipxe?namespace=team-b")
+		assert.Equal(t, http.StatusNotFound, code)
+	})
+}
+
+func TestServer_BootAsset(t *testing.T) {
+	srv := newBootServer(t)
+
+	code, body := get(t, srv.URL+"/boot/assets/amd64/vmlinuz")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "kernel", body)
+
+	// UEFI HTTP boot clients are pointed at iPXE by the proxy DHCP responder.
+	code, body = get(t, srv.URL+"/boot/assets/amd64/ipxe.efi")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "ipxe", body)
+
+	code, _ = get(t, srv.URL+"/boot/assets/amd64/config")
+	assert.Equal(t, http.StatusNotFound, code)
+}
+
+func TestServer_proxyDHCP(t *testing.T) {
+	tests := []struct {
+		name        string
+		bootEnabled bool
+		tftpServer  string
+		err         string
+	}{
+		{name: "boot service disabled", tftpServer: "10.0.0.3", err: "boot service"},
+		{name: "no tftp server", bootEnabled: true, err: "tftp server"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := DefaultConfig()
+			conf.BootEnabled = tt.bootEnabled
+			conf.ProxyDHCPEnabled = true
+			conf.ProxyDHCPServerIP = "10.0.0.2"
+			conf.ProxyDHCPTFTPServer = tt.tftpServer
+
+			_, err := NewServer(conf).proxyDHCP()
+			assert.ErrorContains(t, err, tt.err)
+		})
+	}
+}
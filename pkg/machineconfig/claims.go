@@ -0,0 +1,123 @@
+package machineconfig
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/lukaspj/talos-cluster-operator/pkg/api/v1alpha1"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// allocateMachine allocates a name and an address for a Machine and claims the address. Addresses claimed by
+// another replica or server are skipped, the allocator keeps them reserved until their Machine reaches the cache.
+func (s *Server) allocateMachine(ctx context.Context, machines []v1alpha1.Machine, namespace string,
+	name func(taken func(name string) bool) (string, error)) (*net.IPNet, string, error) {
+	for {
+		ip, machineName, err := s.allocator.allocate(machines, s.Config.MachineCIDR, s.Config.MachineSubnetSize, s.Config.MachineGateway,
+			namespace, name)
+		if err != nil || ip.IP == nil {
+			return ip, machineName, err
+		}
+
+		m := &v1alpha1.Machine{
+			ObjectMeta: metav1.ObjectMeta{Name: machineName, Namespace: namespace},
+			Spec:       v1alpha1.MachineSpec{IP: ip.IP.String()},
+		}
+		claimed, err := s.claimIP(ctx, m)
+		if err != nil {
+			s.allocator.release(m)
+			return nil, "", err
+		}
+		if claimed {
+			return ip, machineName, nil
+		}
+		s.allocator.releaseName(m)
+	}
+}
+
+// claimIP claims the address of the Machine through a Lease named after it in our namespace. The API server only
+// lets one replica, or one server, create it, whatever the state of their caches. It reports false when the address
+// is claimed by another Machine.
+func (s *Server) claimIP(ctx context.Context, m *v1alpha1.Machine) (bool, error) {
+	claim := &coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      v1alpha1.IPClaimName(m.Spec.IP),
+			Namespace: s.namespace(),
+		},
+		Spec: coordinationv1.LeaseSpec{
+			HolderIdentity: ptr.To(client.ObjectKeyFromObject(m).String()),
+			AcquireTime:    &metav1.MicroTime{Time: time.Now()},
+		},
+	}
+
+	err := s.client.Create(ctx, claim.DeepCopy(), client.FieldOwner(FieldOwner))
+	if !k8serrors.IsAlreadyExists(err) {
+		return err == nil, err
+	}
+
+	released, err := s.releaseStaleClaim(ctx, client.ObjectKeyFromObject(claim), m.Spec.IP)
+	if err != nil || !released {
+		return false, err
+	}
+	err = s.client.Create(ctx, claim, client.FieldOwner(FieldOwner))
+	if k8serrors.IsAlreadyExists(err) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// releaseStaleClaim deletes a claim whose Machine does not exist or has another address, left behind by a server
+// which went away between claiming an address and creating the Machine, or a Machine deleted without the operator.
+// Claims younger than the reservation TTL are left alone, their Machine may just not have reached the cache yet.
+func (s *Server) releaseStaleClaim(ctx context.Context, key types.NamespacedName, ip string) (bool, error) {
+	var claim coordinationv1.Lease
+	if err := s.client.Get(ctx, key, &claim); err != nil {
+		return false, client.IgnoreNotFound(err)
+	}
+	claimed := claim.CreationTimestamp.Time
+	if claim.Spec.AcquireTime != nil {
+		claimed = claim.Spec.AcquireTime.Time
+	}
+	if time.Since(claimed) < reservationTTL || claim.Spec.HolderIdentity == nil {
+		return false, nil
+	}
+
+	namespace, name, _ := strings.Cut(*claim.Spec.HolderIdentity, "/")
+	var holder v1alpha1.Machine
+	err := s.client.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, &holder)
+	if err == nil && holder.Spec.IP == ip {
+		return false, nil
+	}
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return false, err
+	}
+
+	slog.Info("releasing stale address claim", "claim", key.Name, "machine", *claim.Spec.HolderIdentity)
+	err = s.client.Delete(ctx, &claim, client.Preconditions{UID: &claim.UID, ResourceVersion: &claim.ResourceVersion})
+	if err != nil && !k8serrors.IsNotFound(err) && !k8serrors.IsConflict(err) {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// releaseIP deletes the claim of a Machine which was rolled back.
+func (s *Server) releaseIP(ctx context.Context, m *v1alpha1.Machine) {
+	if net.ParseIP(m.Spec.IP) == nil {
+		return
+	}
+
+	claim := &coordinationv1.Lease{ObjectMeta: metav1.ObjectMeta{Name: v1alpha1.IPClaimName(m.Spec.IP), Namespace: s.namespace()}}
+	if err := s.client.Delete(ctx, claim); client.IgnoreNotFound(err) != nil {
+		slog.Error("unable to release address claim, it is released once it is stale", "machine", m.Name, "ip", m.Spec.IP, "error", err)
+	}
+}
@@ -0,0 +1,73 @@
+package machineconfig
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lukaspj/talos-cluster-operator/pkg/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestServer_allocateMachine(t *testing.T) {
+	ctx := context.Background()
+
+	scheme := runtime.NewScheme()
+	require.NoError(t, coordinationv1.AddToScheme(scheme))
+	require.NoError(t, v1alpha1.AddToScheme(scheme))
+
+	conf := DefaultConfig()
+	conf.MachineCIDR = "10.0.0.0/29"
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		// Left behind by a server which went away before creating the Machine.
+		&coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{Name: v1alpha1.IPClaimName("10.0.0.0"), Namespace: conf.Namespace},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity: ptr.To("machines/gone"),
+				AcquireTime:    &metav1.MicroTime{Time: time.Now().Add(-time.Hour)},
+			},
+		},
+		// Claimed a moment ago, its Machine may not have reached the cache.
+		&coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{Name: v1alpha1.IPClaimName("10.0.0.1"), Namespace: conf.Namespace},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity: ptr.To("machines/new"),
+				AcquireTime:    &metav1.MicroTime{Time: time.Now()},
+			},
+		},
+	).Build()
+
+	named := func(prefix string) func(taken func(string) bool) (string, error) {
+		return func(taken func(string) bool) (string, error) {
+			return renderMachineName(prefix+"-{{ .Index }}", NameData{}, taken)
+		}
+	}
+
+	// The replicas share the API server, but neither sees the Machines of the other, as with lagging caches.
+	replicas := []*Server{NewServer(conf), NewServer(conf)}
+	var ips []string
+	for i, prefix := range []string{"a", "b"} {
+		replicas[i].client = c
+		ip, name, err := replicas[i].allocateMachine(ctx, nil, "machines", named(prefix))
+		require.NoError(t, err)
+		assert.Equal(t, prefix+"-1", name)
+		ips = append(ips, ip.IP.String())
+	}
+	assert.Equal(t, []string{"10.0.0.0", "10.0.0.2"}, ips)
+
+	var claim coordinationv1.Lease
+	require.NoError(t, c.Get(ctx, client.ObjectKey{Namespace: conf.Namespace, Name: v1alpha1.IPClaimName("10.0.0.0")}, &claim))
+	assert.Equal(t, "machines/a-1", *claim.Spec.HolderIdentity)
+
+	replicas[1].releaseIP(ctx, &v1alpha1.Machine{Spec: v1alpha1.MachineSpec{IP: "10.0.0.2"}})
+	err := c.Get(ctx, client.ObjectKey{Namespace: conf.Namespace, Name: v1alpha1.IPClaimName("10.0.0.2")}, &claim)
+	assert.True(t, k8serrors.IsNotFound(err))
+}
@@ -0,0 +1,154 @@
+package machineconfig
+
+import (
+	"context"
+	"log/slog"
+	"path/filepath"
+
+	"github.com/lukaspj/talos-cluster-operator/pkg/api/v1alpha1"
+	"github.com/lukaspj/talos-cluster-operator/pkg/talosclient"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/util/homedir"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// initClients creates the Kubernetes and Talos clients shared by every request. Machines, Clusters and patch
+// ConfigMaps are read from an informer cache, which Start runs until the server stops.
+func (s *Server) initClients() error {
+	if s.talos == nil {
+		s.talos = talosclient.NewPool(s.Config.TalosClientIdleTimeout)
+	}
+	if s.kube != nil && s.client != nil {
+		return nil
+	}
+
+	clusterConfig, err := restConfig()
+	if err != nil {
+		return err
+	}
+
+	if s.kube == nil {
+		s.kube, err = kubernetes.NewForConfig(clusterConfig)
+		if err != nil {
+			slog.Error("failed to initialise Kubernetes client", "error", err)
+			return err
+		}
+	}
+
+	if s.client == nil {
+		scheme := runtime.NewScheme()
+		if err := clientgoscheme.AddToScheme(scheme); err != nil {
+			slog.Error("unable to add to scheme", "error", err)
+			return err
+		}
+		if err := v1alpha1.AddToScheme(scheme); err != nil {
+			slog.Error("unable to add to scheme", "error", err)
+			return err
+		}
+
+		if err := s.initCachedClient(clusterConfig, scheme); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// initCachedClient creates the informer cache and the client reading through it. Secrets and address claims are read
+// from the API server, the server only reads the talosconfig and its claims must not lag.
+func (s *Server) initCachedClient(clusterConfig *rest.Config, scheme *runtime.Scheme) error {
+	var err error
+	s.cache, err = s.newCache(clusterConfig, scheme)
+	if err != nil {
+		slog.Error("failed to initialise informer cache", "error", err)
+		return err
+	}
+
+	s.client, err = client.New(clusterConfig, client.Options{
+		Scheme: scheme,
+		Cache: &client.CacheOptions{
+			Reader:     s.cache,
+			DisableFor: []client.Object{&corev1.Secret{}, &coordinationv1.Lease{}},
+		},
+	})
+	if err != nil {
+		slog.Error("failed to initialise controller client", "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// newCache creates the informer cache of the standalone server.
+func (s *Server) newCache(clusterConfig *rest.Config, scheme *runtime.Scheme) (cache.Cache, error) {
+	c, err := cache.New(clusterConfig, cache.Options{
+		Scheme:   scheme,
+		ByObject: s.Config.CacheByObject(s.namespace()),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := registerInformers(c); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// CacheByObject returns the cache options of the kinds the server reads: the Machines of every namespace, as they
+// share the machine CIDR, and the ConfigMaps of the namespaces patches are read from. Clusters are read wherever
+// the cache watches them, the installer images of Clusters out of the operator's reach are never set anyway.
+func (c *Config) CacheByObject(namespace string) map[client.Object]cache.ByObject {
+	namespaces := map[string]cache.Config{namespace: {}}
+	for _, ns := range c.Namespaces {
+		namespaces[ns] = cache.Config{}
+	}
+
+	return map[client.Object]cache.ByObject{
+		&v1alpha1.Machine{}: {Namespaces: map[string]cache.Config{cache.AllNamespaces: {}}},
+		&corev1.ConfigMap{}: {Namespaces: namespaces},
+	}
+}
+
+// registerInformers registers the informers up front, readiness waits for them to sync rather than the first
+// request.
+func registerInformers(c cache.Cache) error {
+	ctx := context.Background()
+	for _, obj := range []client.Object{&v1alpha1.Machine{}, &v1alpha1.Cluster{}, &corev1.ConfigMap{}} {
+		if _, err := c.GetInformer(ctx, obj); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func restConfig() (*rest.Config, error) {
+	clusterConfig, err := rest.InClusterConfig()
+	if err == nil {
+		return clusterConfig, nil
+	}
+	slog.Error("failed to get in-cluster configuration", "error", err)
+
+	var kubeconfig string
+	if home := homedir.HomeDir(); home != "" {
+		kubeconfig = filepath.Join(home, ".kube", "config")
+	}
+
+	// use the current context in kubeconfig
+	clusterConfig, err = clientcmd.BuildConfigFromFlags("", kubeconfig)
+	if err != nil {
+		slog.Error("failed to get kubernetes client configuration", "error", err)
+		return nil, err
+	}
+
+	return clusterConfig, nil
+}
@@ -0,0 +1,66 @@
+package machineconfig
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cosi-project/runtime/pkg/resource"
+	"github.com/cosi-project/runtime/pkg/state"
+	"github.com/lukaspj/talos-cluster-operator/pkg/tracing"
+	talosv1alpha1 "github.com/siderolabs/talos/pkg/machinery/config/types/v1alpha1"
+	yaml "go.yaml.in/yaml/v4"
+)
+
+// clusterSource reads the machine config of the management cluster, whose secrets every rendered config shares.
+// The version identifies the secrets in the audit records.
+type clusterSource interface {
+	MachineConfig(ctx context.Context) (config *talosv1alpha1.Config, version string, err error)
+}
+
+// talosCluster reads the machine config from the Talos API of the management cluster.
+type talosCluster struct {
+	server *Server
+}
+
+func (c *talosCluster) MachineConfig(ctx context.Context) (*talosv1alpha1.Config, string, error) {
+	spanCtx, span := tracer.Start(ctx, "load talosconfig")
+	credentials, err := c.server.talosCredentials(spanCtx)
+	tracing.End(span, err)
+	if err != nil {
+		return nil, "", fmt.Errorf("load talosconfig: %w", err)
+	}
+
+	spanCtx, span = tracer.Start(ctx, "talos client")
+	ctl, err := c.server.talos.Client(spanCtx, credentials)
+	tracing.End(span, err)
+	if err != nil {
+		return nil, "", fmt.Errorf("initialise talosctl: %w", err)
+	}
+
+	talosNamespace := "config"
+	spanCtx, span = tracer.Start(ctx, "resolve talos machine config kind")
+	resourceKind, err := ctl.ResolveResourceKind(spanCtx, &talosNamespace, "machineconfig")
+	tracing.End(span, err)
+	if err != nil {
+		return nil, "", fmt.Errorf("get talos machine config kind: %w", err)
+	}
+
+	spanCtx, span = tracer.Start(ctx, "get talos machine config")
+	r, err := ctl.COSI.Get(spanCtx, resource.NewMetadata(talosNamespace, resourceKind.TypedSpec().Type, "v1alpha1", resource.VersionUndefined),
+		state.WithGetUnmarshalOptions(state.WithSkipProtobufUnmarshal()))
+	tracing.End(span, err)
+	if err != nil {
+		return nil, "", fmt.Errorf("get talos machine config spec: %w", err)
+	}
+
+	conf, err := yaml.Marshal(r.Spec())
+	if err != nil {
+		return nil, "", fmt.Errorf("marshal talos machine config spec: %w", err)
+	}
+	var machineConfig talosv1alpha1.Config
+	if err := yaml.Unmarshal(conf, &machineConfig); err != nil {
+		return nil, "", fmt.Errorf("unmarshal talos machine config spec: %w", err)
+	}
+
+	return &machineConfig, r.Metadata().Version().String(), nil
+}
@@ -1,24 +1,117 @@
 package machineconfig
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+)
 
 type Config struct {
-	Port              int
-	TalosConfigPath   string
-	Namespace         string
+	Port            int
+	TalosConfigPath string
+	// TalosConfigSecretName is the Secret in the server's namespace holding the talosconfig under
+	// TalosConfigSecretKey. It takes precedence over TalosConfigPath when set.
+	TalosConfigSecretName string
+	TalosConfigSecretKey  string
+	Namespace             string
+	// MachineNamespace is the namespace Machines are registered in by requests which do not address a namespace.
+	MachineNamespace string
+	// Namespaces lists the namespaces which can be addressed through /namespaces/{namespace}/machineconfig/new.
+	// Both the patch ConfigMap and the registered Machine of such a request live in the addressed namespace.
+	Namespaces        []string
 	MachineCIDR       string
 	MachineSubnetSize int
+	// MachineGateway is the default gateway of the machine CIDR. No default route is added when empty, or when the
+	// patch routes the default network itself.
+	MachineGateway string
+	// MachineNameservers are added to the nameservers of the patch.
+	MachineNameservers []string
+	// MachineVLAN is the VLAN ID the machine address is placed on, 0 leaves it untagged.
+	MachineVLAN int
+	// MachineBondMode bonds the machine interfaces with this mode, e.g. 802.3ad. The bond members are the
+	// interfaces using MachineBondDriver, or the interface the machine booted with when empty.
+	MachineBondMode   string
+	MachineBondDriver string
+	// MachineNameTemplate is the Go template registered Machines and their Talos hostnames are named by, see
+	// NameData. A patch ConfigMap overrides it with its nameTemplate key.
+	MachineNameTemplate string
+	// TalosClientIdleTimeout is how long an unused Talos client is kept open.
+	TalosClientIdleTimeout time.Duration
+	// MaxConcurrentRenders bounds the machine configs rendered at once, 0 lifts the bound. Requests wait up to
+	// RenderQueueTimeout for their turn before they are asked to retry.
+	MaxConcurrentRenders int
+	RenderQueueTimeout   time.Duration
+	// RateLimit is the rate of machine config requests per second accepted from one source address, allowing bursts
+	// of RateLimitBurst. The source is the address of the connection, so machines behind one proxy, or a Service
+	// with externalTrafficPolicy Cluster, share its limit. 0, the default, disables rate limiting.
+	RateLimit      float64
+	RateLimitBurst int
+	// MetricsAddr is the address Prometheus metrics are served on, "0" disables them.
+	MetricsAddr string
+	// OTLPEndpoint is the OTLP gRPC collector request traces are exported to, e.g. otel-collector:4317. Tracing is
+	// disabled when empty.
+	OTLPEndpoint string `fang:"otlp_endpoint"`
+	// OTLPInsecure exports traces without TLS.
+	OTLPInsecure bool `fang:"otlp_insecure"`
+
+	// AuditSinks lists where issued machine configs are recorded: "event" records an Event on the Machine, "file"
+	// appends JSON lines to AuditFile and "webhook" posts JSON to AuditWebhookURL.
+	AuditSinks      []string
+	AuditFile       string
+	AuditWebhookURL string
+
+	// BootEnabled serves iPXE scripts and the Talos kernel and initramfs under /boot.
+	BootEnabled bool
+	// BootImageCache is the directory holding the Talos boot assets as <arch>/vmlinuz and <arch>/initramfs.xz, and
+	// the iPXE binary UEFI HTTP boot clients load as <arch>/ipxe.efi.
+	BootImageCache string
+	// BootBaseURL is the URL network booted machines reach the server on. The host of the boot request is used when
+	// empty.
+	BootBaseURL string
+	// BootKernelArgs are passed to the kernel of every network booted machine.
+	BootKernelArgs []string
+	// BootHintTTL is how long a machine seen network booting is remembered for correlating its machine config
+	// request.
+	BootHintTTL time.Duration
+
+	// The proxy DHCP fields are tagged as their acronyms would otherwise run together in the environment variable
+	// names.
+
+	// ProxyDHCPEnabled answers PXE clients with the boot service, without handing out leases. It requires
+	// BootEnabled.
+	ProxyDHCPEnabled bool `fang:"proxy_dhcp_enabled"`
+	// ProxyDHCPServerIP is the IPv4 address of the server advertised to PXE clients.
+	ProxyDHCPServerIP string `fang:"proxy_dhcp_server_ip"`
+	// ProxyDHCPTFTPServer is the TFTP server serving iPXE to PXE ROMs which cannot boot over HTTP, as undionly.kpxe,
+	// ipxe.efi and ipxe-arm64.efi. The server does not serve TFTP itself, so it is required.
+	ProxyDHCPTFTPServer string `fang:"proxy_dhcp_tftp_server"`
 }
 
 func DefaultConfig() Config {
 	return Config{
-		Port:            4242,
-		TalosConfigPath: "/var/run/secrets/talos.dev/config",
-		Namespace:       "default",
-		MachineCIDR:     "",
+		Port:                 4242,
+		MetricsAddr:          ":9090",
+		TalosConfigPath:      "/var/run/secrets/talos.dev/config",
+		TalosConfigSecretKey: "config",
+		Namespace:            "default",
+		MachineNamespace:     "machines",
+		MachineCIDR:          "",
+		MachineNameTemplate:  "nucas-node-{{ .Random }}",
+
+		TalosClientIdleTimeout: 10 * time.Minute,
+		MaxConcurrentRenders:   16,
+		RenderQueueTimeout:     30 * time.Second,
+		RateLimitBurst:         5,
+		AuditSinks:             []string{AuditSinkEvent},
+
+		BootImageCache: "/var/cache/talos",
+		BootKernelArgs: []string{
+			"talos.platform=metal", "console=tty0", "init_on_alloc=1", "slab_nomerge", "pti=on", "consoleblank=0",
+			"nvme_core.io_timeout=4294967295", "printk.devkmsg=on", "ima_template=ima-ng", "ima_appraise=fix", "ima_hash=sha512",
+		},
+		BootHintTTL: 30 * time.Minute,
 	}
 }
 
 func (c *Config) String() string {
-	return fmt.Sprintf("Config{Port: %d, Namespace: %s, TalosConfigPath: %s, MachineCIDR: %s, MachineSubnetSize: %d}", c.Port, c.Namespace, c.TalosConfigPath, c.MachineCIDR, c.MachineSubnetSize)
+	return fmt.Sprintf("Config{Port: %d, MetricsAddr: %s, Namespace: %s, MachineNamespace: %s, Namespaces: %v, TalosConfigPath: %s, TalosConfigSecretName: %s, TalosConfigSecretKey: %s, MachineCIDR: %s, MachineSubnetSize: %d, MachineGateway: %s, MachineNameservers: %v, MachineVLAN: %d, MachineBondMode: %s, MachineBondDriver: %s, MachineNameTemplate: %q, TalosClientIdleTimeout: %s, MaxConcurrentRenders: %d, RenderQueueTimeout: %s, RateLimit: %g, RateLimitBurst: %d, OTLPEndpoint: %s, OTLPInsecure: %t, AuditSinks: %v, AuditFile: %s, AuditWebhookURL: %s, BootEnabled: %t, BootImageCache: %s, BootBaseURL: %s, BootKernelArgs: %v, BootHintTTL: %s, ProxyDHCPEnabled: %t, ProxyDHCPServerIP: %s, ProxyDHCPTFTPServer: %s}", c.Port, c.MetricsAddr, c.Namespace, c.MachineNamespace, c.Namespaces, c.TalosConfigPath, c.TalosConfigSecretName, c.TalosConfigSecretKey, c.MachineCIDR, c.MachineSubnetSize, c.MachineGateway, c.MachineNameservers, c.MachineVLAN, c.MachineBondMode, c.MachineBondDriver, c.MachineNameTemplate, c.TalosClientIdleTimeout, c.MaxConcurrentRenders, c.RenderQueueTimeout, c.RateLimit, c.RateLimitBurst, c.OTLPEndpoint, c.OTLPInsecure, c.AuditSinks, c.AuditFile, c.AuditWebhookURL, c.BootEnabled, c.BootImageCache, c.BootBaseURL, c.BootKernelArgs, c.BootHintTTL, c.ProxyDHCPEnabled, c.ProxyDHCPServerIP, c.ProxyDHCPTFTPServer)
 }
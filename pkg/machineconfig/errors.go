@@ -0,0 +1,141 @@
+package machineconfig
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// retryAfter is the Retry-After sent with transient failures. Talos retries fetching its config until it succeeds.
+const retryAfter = 10 * time.Second
+
+// ErrIPPoolExhausted is returned when every address of the machine CIDR is allocated. Addresses are released as
+// Machines are deleted, so the request is worth retrying.
+var ErrIPPoolExhausted = errors.New("no more IPs available in CIDR")
+
+// statusError assigns a status code to an error. Errors without one are answered with 500, or 503 when transient.
+type statusError struct {
+	status     int
+	retryAfter time.Duration
+	err        error
+}
+
+func (e *statusError) Error() string {
+	if e.err == nil {
+		return http.StatusText(e.status)
+	}
+
+	return e.err.Error()
+}
+
+func (e *statusError) Unwrap() error {
+	return e.err
+}
+
+func badRequest(err error) error {
+	return &statusError{status: http.StatusBadRequest, err: err}
+}
+
+func notFound(err error) error {
+	return &statusError{status: http.StatusNotFound, err: err}
+}
+
+func conflict(err error) error {
+	return &statusError{status: http.StatusConflict, err: err}
+}
+
+func tooManyRequests(err error, after time.Duration) error {
+	return &statusError{status: http.StatusTooManyRequests, retryAfter: after, err: err}
+}
+
+func unavailable(err error, after time.Duration) error {
+	return &statusError{status: http.StatusServiceUnavailable, retryAfter: after, err: err}
+}
+
+// kubeError maps the errors of the Kubernetes API to status codes, a missing object being the client's mistake.
+func kubeError(err error) error {
+	switch {
+	case k8serrors.IsNotFound(err):
+		return notFound(err)
+	case k8serrors.IsAlreadyExists(err), k8serrors.IsConflict(err):
+		return conflict(err)
+	}
+
+	return err
+}
+
+// transient reports whether a failure is expected to resolve on its own, and after how long to retry.
+func transient(err error) (time.Duration, bool) {
+	if seconds, ok := k8serrors.SuggestsClientDelay(err); ok {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if k8serrors.IsServerTimeout(err) || k8serrors.IsTimeout(err) || k8serrors.IsTooManyRequests(err) ||
+		k8serrors.IsServiceUnavailable(err) || errors.Is(err, context.DeadlineExceeded) {
+		return retryAfter, true
+	}
+
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted:
+		return retryAfter, true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return retryAfter, true
+	}
+
+	return 0, false
+}
+
+// problem is an RFC 7807 problem details body.
+type problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance"`
+	RequestID string `json:"requestID,omitempty"`
+}
+
+// errorResponse answers with an application/problem+json body titled msg. The status code follows from the type of
+// err. The error itself is only included for client errors, server errors may carry internal details.
+func errorResponse(w http.ResponseWriter, req *http.Request, err error, msg string) {
+	code, after := http.StatusInternalServerError, time.Duration(0)
+	var statusErr *statusError
+	if errors.As(err, &statusErr) {
+		code, after = statusErr.status, statusErr.retryAfter
+	} else if d, ok := transient(err); ok {
+		code, after = http.StatusServiceUnavailable, d
+	}
+
+	requestID := middleware.GetReqID(req.Context())
+	slog.Error(msg, "error", err, "status", code, "requestID", requestID)
+
+	p := problem{
+		Type:      "about:blank",
+		Title:     msg,
+		Status:    code,
+		Instance:  req.URL.Path,
+		RequestID: requestID,
+	}
+	if code < http.StatusInternalServerError && err != nil {
+		p.Detail = err.Error()
+	}
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	if after > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(after.Round(time.Second).Seconds())))
+	}
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(p)
+}
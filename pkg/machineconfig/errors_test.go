@@ -0,0 +1,64 @@
+package machineconfig
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestErrorResponse(t *testing.T) {
+	configMaps := schema.GroupResource{Resource: "configmaps"}
+
+	tests := []struct {
+		name       string
+		err        error
+		status     int
+		retryAfter string
+		detail     string
+	}{
+		{name: "untyped", err: errors.New("boom"), status: http.StatusInternalServerError},
+		{name: "missing patch", err: kubeError(k8serrors.NewNotFound(configMaps, "workers")), status: http.StatusNotFound, detail: `configmaps "workers" not found`},
+		{name: "bad request without cause", err: badRequest(nil), status: http.StatusBadRequest, detail: "Bad Request"},
+		{name: "pool exhausted", err: unavailable(ErrIPPoolExhausted, time.Minute), status: http.StatusServiceUnavailable, retryAfter: "60"},
+		{name: "throttled", err: k8serrors.NewTooManyRequests("slow down", 3), status: http.StatusServiceUnavailable, retryAfter: "3"},
+		{name: "talos unavailable", err: fmt.Errorf("get config: %w", status.Error(codes.Unavailable, "connection refused")), status: http.StatusServiceUnavailable, retryAfter: "10"},
+		{name: "deadline", err: context.DeadlineExceeded, status: http.StatusServiceUnavailable, retryAfter: "10"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/machineconfig/new/workers", nil)
+			req = req.WithContext(context.WithValue(req.Context(), middleware.RequestIDKey, "req-1"))
+			w := httptest.NewRecorder()
+
+			errorResponse(w, req, tt.err, "could not render")
+
+			assert.Equal(t, tt.status, w.Code)
+			assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+			assert.Equal(t, tt.retryAfter, w.Header().Get("Retry-After"))
+
+			var p problem
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&p))
+			assert.Equal(t, problem{
+				Type:      "about:blank",
+				Title:     "could not render",
+				Status:    tt.status,
+				Detail:    tt.detail,
+				Instance:  "/machineconfig/new/workers",
+				RequestID: "req-1",
+			}, p)
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package machineconfig
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/lukaspj/talos-cluster-operator/pkg/api/v1alpha1"
+	"github.com/lukaspj/talos-cluster-operator/pkg/readyz"
+	talosv1alpha1 "github.com/siderolabs/talos/pkg/machinery/config/types/v1alpha1"
+	yaml "go.yaml.in/yaml/v4"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+)
+
+// Readyz reports whether the server can render machine configs. /readyz?verbose lists the outcome of every check
+// and /readyz/{check} runs a single one.
+func (s *Server) Readyz(w http.ResponseWriter, req *http.Request) {
+	http.StripPrefix("/readyz", &healthz.Handler{Checks: readyz.Concurrent(s.ReadyzChecks())}).ServeHTTP(w, req)
+}
+
+// Livez only reports that the server is serving, a dependency being down is no reason to restart it.
+func (s *Server) Livez(w http.ResponseWriter, _ *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+
+// ReadyzChecks returns the readiness checks of the server by name. The operator embedding the server serves them
+// alongside its own.
+func (s *Server) ReadyzChecks() map[string]readyz.Check {
+	checks := map[string]readyz.Check{
+		"kubernetes-api": s.kubernetesAPIReady,
+		"talos":          s.talosReady,
+		"machine-patch":  s.machinePatchReady,
+		"ip-pool":        s.ipPoolReady,
+	}
+	if s.cache != nil {
+		checks["informer-sync"] = s.informersSynced
+	}
+
+	return checks
+}
+
+// kubernetesAPIReady asks the API server for its own readiness, which every service account may read.
+func (s *Server) kubernetesAPIReady(ctx context.Context) error {
+	return s.kube.Discovery().RESTClient().Get().AbsPath("/readyz").Do(ctx).Error()
+}
+
+// informersSynced fails until the Machines and ConfigMaps requests are served from have been listed.
+func (s *Server) informersSynced(ctx context.Context) error {
+	if !s.cache.WaitForCacheSync(ctx) {
+		return errors.New("informer caches are not synced")
+	}
+
+	return nil
+}
+
+// talosReady reaches the Talos API of the management cluster the machine configs are derived from.
+func (s *Server) talosReady(ctx context.Context) error {
+	credentials, err := s.talosCredentials(ctx)
+	if err != nil {
+		return fmt.Errorf("load talosconfig: %w", err)
+	}
+	ctl, err := s.talos.Client(ctx, credentials)
+	if err != nil {
+		return err
+	}
+
+	_, err = ctl.Version(ctx)
+	return err
+}
+
+// machinePatchReady loads the patch ConfigMap used by requests which do not name a config.
+func (s *Server) machinePatchReady(ctx context.Context) error {
+	var configMap corev1.ConfigMap
+	err := s.client.Get(ctx, types.NamespacedName{Namespace: s.namespace(), Name: defaultConfigName}, &configMap)
+	if err != nil {
+		return err
+	}
+
+	var configPatch talosv1alpha1.Config
+	if err := yaml.Unmarshal([]byte(configMap.Data["machineconfig"]), &configPatch); err != nil {
+		return fmt.Errorf("unmarshal machine patch: %w", err)
+	}
+
+	return nil
+}
+
+// ipPoolReady loads the Machines addresses are allocated against. An exhausted pool does not fail the check, as
+// the boot service keeps serving registered machines.
+func (s *Server) ipPoolReady(ctx context.Context) error {
+	if s.Config.MachineCIDR != "" {
+		if _, _, err := net.ParseCIDR(s.Config.MachineCIDR); err != nil {
+			return fmt.Errorf("parse machine CIDR: %w", err)
+		}
+	}
+
+	return s.client.List(ctx, &v1alpha1.MachineList{})
+}
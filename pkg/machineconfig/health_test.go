@@ -0,0 +1,86 @@
+package machineconfig
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lukaspj/talos-cluster-operator/pkg/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/cache/informertest"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newReadyzServer(t *testing.T, conf Config, patch string) *httptest.Server {
+	scheme := runtime.NewScheme()
+	require.NoError(t, v1alpha1.AddToScheme(scheme))
+	require.NoError(t, corev1.AddToScheme(scheme))
+
+	s := NewServer(conf)
+	s.client = fake.NewClientBuilder().WithScheme(scheme).WithObjects(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: defaultConfigName, Namespace: conf.Namespace},
+		Data:       map[string]string{"machineconfig": patch},
+	}).Build()
+	s.kube = kubefake.NewClientset()
+
+	srv := httptest.NewServer(s.Routes())
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func TestServer_Readyz(t *testing.T) {
+	conf := DefaultConfig()
+	conf.MachineCIDR = "10.0.0.0/24"
+	srv := newReadyzServer(t, conf, "machine:\n  type: worker\n")
+
+	code, body := get(t, srv.URL+"/readyz/machine-patch")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "ok", body)
+
+	code, _ = get(t, srv.URL+"/readyz/unknown")
+	assert.Equal(t, http.StatusNotFound, code)
+
+	code, body = get(t, srv.URL+"/readyz?verbose&exclude=kubernetes-api&exclude=talos")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, "[+]ip-pool ok\n")
+	assert.Contains(t, body, "[+]machine-patch ok\n")
+}
+
+func TestServer_ReadyzFailing(t *testing.T) {
+	conf := DefaultConfig()
+	conf.MachineCIDR = "10.0.0.0/33"
+	srv := newReadyzServer(t, conf, "machine: [")
+
+	code, body := get(t, srv.URL+"/readyz?exclude=kubernetes-api&exclude=talos")
+	assert.Equal(t, http.StatusInternalServerError, code)
+	assert.Contains(t, body, "[-]ip-pool failed: reason withheld\n")
+	assert.Contains(t, body, "[-]machine-patch failed: reason withheld\n")
+
+	code, body = get(t, srv.URL+"/readyz/ip-pool")
+	assert.Equal(t, http.StatusInternalServerError, code)
+	assert.Contains(t, body, "parse machine CIDR")
+}
+
+func TestServer_ReadyzInformerSync(t *testing.T) {
+	s := NewServer(DefaultConfig())
+	informers := &informertest.FakeInformers{Synced: ptr.To(false)}
+	s.cache = informers
+	srv := httptest.NewServer(s.Routes())
+	t.Cleanup(srv.Close)
+
+	code, body := get(t, srv.URL+"/readyz/informer-sync")
+	assert.Equal(t, http.StatusInternalServerError, code)
+	assert.Contains(t, body, "informer caches are not synced")
+
+	informers.Synced = ptr.To(true)
+	code, body = get(t, srv.URL+"/readyz/informer-sync")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "ok", body)
+}
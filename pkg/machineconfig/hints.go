@@ -0,0 +1,91 @@
+package machineconfig
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BootHint is a machine seen network booting before it requested a machine config.
+type BootHint struct {
+	MAC string
+	// UUIDs holds the client UUID in both the big endian and the SMBIOS mixed endian representation, as firmware
+	// disagrees on the byte order.
+	UUIDs []string
+	Arch  string
+	Seen  time.Time
+}
+
+// hintStore keeps boot hints in memory until they are used or expire.
+type hintStore struct {
+	ttl time.Duration
+
+	mu    sync.Mutex
+	hints map[string]BootHint
+}
+
+func newHintStore(ttl time.Duration) *hintStore {
+	return &hintStore{ttl: ttl, hints: map[string]BootHint{}}
+}
+
+func (h *hintStore) Record(hint BootHint) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+	for mac, old := range h.hints {
+		if now.Sub(old.Seen) > h.ttl {
+			delete(h.hints, mac)
+		}
+	}
+
+	hint.Seen = now
+	h.hints[hint.MAC] = hint
+}
+
+// Lookup returns the hint of the MAC address or, when the MAC is unknown, the hint with the UUID.
+func (h *hintStore) Lookup(mac, uuid string) (BootHint, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	hint, ok := h.hints[mac]
+	if !ok && uuid != "" {
+		for _, candidate := range h.hints {
+			for _, u := range candidate.UUIDs {
+				if strings.EqualFold(u, uuid) {
+					hint, ok = candidate, true
+				}
+			}
+		}
+	}
+	if !ok || time.Since(hint.Seen) > h.ttl {
+		return BootHint{}, false
+	}
+
+	return hint, true
+}
+
+func (h *hintStore) Forget(mac string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.hints, mac)
+}
+
+// newBootHint builds the hint of a network booting machine from its MAC address and client UUID.
+func newBootHint(mac net.HardwareAddr, uuid []byte, arch string) BootHint {
+	hint := BootHint{MAC: mac.String(), Arch: arch}
+	if len(uuid) == 16 {
+		mixed := []byte{uuid[3], uuid[2], uuid[1], uuid[0], uuid[5], uuid[4], uuid[7], uuid[6]}
+		mixed = append(mixed, uuid[8:]...)
+		hint.UUIDs = []string{formatUUID(uuid), formatUUID(mixed)}
+	}
+
+	return hint
+}
+
+func formatUUID(b []byte) string {
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
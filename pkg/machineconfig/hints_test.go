@@ -0,0 +1,39 @@
+package machineconfig
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHintStore(t *testing.T) {
+	mac, _ := net.ParseMAC("AA:BB:CC:DD:EE:FF")
+	uuid := []byte{0x00, 0x11, 0x22, 0x33, 0x44, 0x55, 0x66, 0x77, 0x88, 0x99, 0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}
+
+	hints := newHintStore(time.Minute)
+	hints.Record(newBootHint(mac, uuid, "amd64"))
+
+	hint, ok := hints.Lookup("aa:bb:cc:dd:ee:ff", "")
+	assert.True(t, ok)
+	assert.Equal(t, "amd64", hint.Arch)
+
+	hint, ok = hints.Lookup("", "00112233-4455-6677-8899-AABBCCDDEEFF")
+	assert.True(t, ok)
+	assert.Equal(t, "aa:bb:cc:dd:ee:ff", hint.MAC)
+
+	// SMBIOS encodes the first three fields little endian.
+	_, ok = hints.Lookup("", "33221100-5544-7766-8899-aabbccddeeff")
+	assert.True(t, ok)
+
+	hints.Forget("aa:bb:cc:dd:ee:ff")
+	_, ok = hints.Lookup("aa:bb:cc:dd:ee:ff", "")
+	assert.False(t, ok)
+
+	expired := newHintStore(0)
+	expired.Record(newBootHint(mac, nil, "amd64"))
+	time.Sleep(time.Millisecond)
+	_, ok = expired.Lookup("aa:bb:cc:dd:ee:ff", "")
+	assert.False(t, ok)
+}
@@ -0,0 +1,40 @@
+package machineconfig
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/lukaspj/talos-cluster-operator/pkg/api/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// installerImage returns the installer image of the first MachineSet, by Cluster, whose machines request their
+// config with the patch. Machines install it right away, rather than being upgraded to it after registering.
+func (s *Server) installerImage(ctx context.Context, configName, machineNamespace string) (string, error) {
+	var clusters v1alpha1.ClusterList
+	if err := s.client.List(ctx, &clusters); err != nil {
+		return "", err
+	}
+	slices.SortFunc(clusters.Items, func(a, b v1alpha1.Cluster) int {
+		return strings.Compare(client.ObjectKeyFromObject(&a).String(), client.ObjectKeyFromObject(&b).String())
+	})
+
+	for _, cluster := range clusters.Items {
+		if ns := cluster.MachinesNamespace(); ns != "" && ns != machineNamespace {
+			continue
+		}
+		for _, set := range cluster.Spec.MachineSets() {
+			if set.Config != configName {
+				continue
+			}
+			for _, status := range cluster.Status.MachineSets {
+				if status.Name == set.Name && status.InstallerImage != "" {
+					return status.InstallerImage, nil
+				}
+			}
+		}
+	}
+
+	return "", nil
+}
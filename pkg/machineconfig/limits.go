@@ -0,0 +1,217 @@
+package machineconfig
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// ErrBusy is returned when a machine config request waited too long for its turn to be rendered.
+var ErrBusy = errors.New("too many machine config requests in flight")
+
+// limitRender protects the render of machine configs from boot storms, when a whole rack powers on at once. Requests
+// are rate limited per source address, concurrent requests of the same hardware share one render and the renders
+// run in a bounded number of slots, bounding the load on the Kubernetes and Talos APIs.
+func (s *Server) limitRender(next http.HandlerFunc) http.HandlerFunc {
+	return s.rateLimit(s.coalesce(s.bounded(next)))
+}
+
+// bounded waits for a free render slot, up to Config.RenderQueueTimeout, before asking the client to retry.
+func (s *Server) bounded(next http.HandlerFunc) http.HandlerFunc {
+	if s.renderSlots == nil {
+		return next
+	}
+
+	return func(w http.ResponseWriter, req *http.Request) {
+		ctx, cancel := context.WithTimeout(req.Context(), s.Config.RenderQueueTimeout)
+		defer cancel()
+
+		select {
+		case s.renderSlots <- struct{}{}:
+		case <-ctx.Done():
+			errorResponse(w, req, unavailable(ErrBusy, retryAfter), "too many machine config requests")
+			return
+		}
+		defer func() { <-s.renderSlots }()
+
+		next(w, req)
+	}
+}
+
+// coalesce lets concurrent requests of the same hardware share the render of the first, rather than each
+// registering a Machine. Talos retries its request when the first one takes too long.
+func (s *Server) coalesce(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		key := hardwareKey(req)
+		if key == "" {
+			next(w, req)
+			return
+		}
+
+		leader := false
+		v, _, _ := s.inflight.Do(key, func() (any, error) {
+			leader = true
+			rec := &recorder{ResponseWriter: w}
+			next(rec, req)
+			rec.header = w.Header().Clone()
+
+			return rec, nil
+		})
+		if leader {
+			return
+		}
+
+		rec := v.(*recorder)
+		if rec.err != nil || rec.body.Len() == 0 {
+			errorResponse(w, req, unavailable(errors.New("the request being coalesced with failed"), retryAfter),
+				"machine config request was not completed")
+			return
+		}
+		for k, values := range rec.header {
+			w.Header()[k] = values
+		}
+		if rec.status != 0 {
+			w.WriteHeader(rec.status)
+		}
+		_, _ = w.Write(rec.body.Bytes())
+	}
+}
+
+// hardwareKey identifies the machine a config is requested for, by the first of its MAC address, UUID and serial
+// the request carries.
+func hardwareKey(req *http.Request) string {
+	query := req.URL.Query()
+	id := ""
+	if hw, err := net.ParseMAC(query.Get("mac")); err == nil {
+		id = "mac=" + hw.String()
+	} else if uuid := query.Get("uuid"); uuid != "" {
+		id = "uuid=" + strings.ToLower(uuid)
+	} else if serial := query.Get("serial"); serial != "" {
+		id = "serial=" + serial
+	} else {
+		return ""
+	}
+
+	return req.PathValue("namespace") + "/" + req.PathValue("configName") + "/" + id
+}
+
+// recorder passes a response through while recording it for the coalesced requests.
+type recorder struct {
+	http.ResponseWriter
+	header http.Header
+	status int
+	body   bytes.Buffer
+	err    error
+}
+
+func (r *recorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	n, err := r.ResponseWriter.Write(b)
+	if err != nil {
+		r.err = err
+	}
+
+	return n, err
+}
+
+type peerKey struct{}
+
+// rememberPeer keeps the address of the connection a request came in on, before middleware.RealIP replaces
+// RemoteAddr with whatever the forwarding headers claim.
+func rememberPeer(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		next.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), peerKey{}, req.RemoteAddr)))
+	})
+}
+
+// peerAddr returns the host of the connection a request came in on.
+func peerAddr(req *http.Request) string {
+	addr, ok := req.Context().Value(peerKey{}).(string)
+	if !ok {
+		addr = req.RemoteAddr
+	}
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+
+	return addr
+}
+
+// rateLimit answers 429 to source addresses exceeding Config.RateLimit. Sources are told apart by the connection
+// rather than the forwarding headers, which any client can set.
+func (s *Server) rateLimit(next http.HandlerFunc) http.HandlerFunc {
+	if s.limiters == nil {
+		return next
+	}
+
+	return func(w http.ResponseWriter, req *http.Request) {
+		source := peerAddr(req)
+
+		if after, ok := s.limiters.allow(source, time.Now()); !ok {
+			errorResponse(w, req, tooManyRequests(errors.New("rate limit exceeded for "+source), max(after, time.Second)),
+				"too many machine config requests")
+			return
+		}
+
+		next(w, req)
+	}
+}
+
+// sourceLimiters holds a token bucket per source address. Buckets which refilled completely are dropped, a new one
+// starts out full all the same.
+type sourceLimiters struct {
+	mu       sync.Mutex
+	limit    rate.Limit
+	burst    int
+	limiters map[string]*rate.Limiter
+	pruned   time.Time
+}
+
+func newSourceLimiters(limit float64, burst int) *sourceLimiters {
+	return &sourceLimiters{
+		limit:    rate.Limit(limit),
+		burst:    max(burst, 1),
+		limiters: map[string]*rate.Limiter{},
+	}
+}
+
+// allow takes a token of the source, or reports how long until the next one is available.
+func (l *sourceLimiters) allow(source string, now time.Time) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.pruned) > time.Minute {
+		for s, limiter := range l.limiters {
+			if limiter.TokensAt(now) >= float64(l.burst) {
+				delete(l.limiters, s)
+			}
+		}
+		l.pruned = now
+	}
+
+	limiter, ok := l.limiters[source]
+	if !ok {
+		limiter = rate.NewLimiter(l.limit, l.burst)
+		l.limiters[source] = limiter
+	}
+
+	r := limiter.ReserveN(now, 1)
+	if delay := r.DelayFrom(now); delay > 0 {
+		r.CancelAt(now)
+		return delay, false
+	}
+
+	return 0, true
+}
@@ -0,0 +1,217 @@
+package machineconfig
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/lukaspj/talos-cluster-operator/pkg/api/v1alpha1"
+	"github.com/siderolabs/talos/pkg/machinery/config/machine"
+	talosv1alpha1 "github.com/siderolabs/talos/pkg/machinery/config/types/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// staticCluster stands in for the Talos API of the management cluster.
+type staticCluster struct {
+	config *talosv1alpha1.Config
+}
+
+func (c *staticCluster) MachineConfig(context.Context) (*talosv1alpha1.Config, string, error) {
+	return c.config, "1", nil
+}
+
+func TestServer_BootStorm(t *testing.T) {
+	if testing.Short() {
+		t.Skip("renders hundreds of machine configs")
+	}
+	const nodes = 200
+
+	scheme := runtime.NewScheme()
+	require.NoError(t, corev1.AddToScheme(scheme))
+	require.NoError(t, coordinationv1.AddToScheme(scheme))
+	require.NoError(t, v1alpha1.AddToScheme(scheme))
+
+	conf := DefaultConfig()
+	conf.MachineCIDR = "10.0.0.0/24"
+	conf.MachineSubnetSize = 24
+	conf.MaxConcurrentRenders = 8
+	// Renders are slow under the race detector, requests are not to give up on their turn however long it takes.
+	conf.RenderQueueTimeout = time.Hour
+	conf.MachineNameTemplate = "node-{{ .Index }}"
+	s := NewServer(conf)
+	input, err := s.placeholderInput()
+	require.NoError(t, err)
+	controlPlane, err := input.Config(machine.TypeControlPlane)
+	require.NoError(t, err)
+	s.cluster = &staticCluster{config: controlPlane.RawV1Alpha1()}
+	s.client = fake.NewClientBuilder().WithScheme(scheme).WithStatusSubresource(&v1alpha1.Machine{}).
+		WithObjects(&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: defaultConfigName, Namespace: conf.Namespace},
+			Data:       map[string]string{"machineconfig": "machine:\n  type: worker\n"},
+		}).Build()
+	srv := httptest.NewServer(s.Routes())
+	t.Cleanup(srv.Close)
+
+	// Every node asks twice, as Talos does when it gives up waiting on the first request.
+	statuses := make([]int, 2*nodes)
+	var wg sync.WaitGroup
+	for i := range 2 * nodes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			node := i % nodes
+			req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/machineconfig/new?mac=52:54:00:00:%02x:%02x", srv.URL, node/256, node%256), nil)
+			if err != nil {
+				return
+			}
+			res, err := http.DefaultClient.Do(req)
+			if err != nil {
+				return
+			}
+			defer res.Body.Close()
+			_, _ = io.Copy(io.Discard, res.Body)
+			statuses[i] = res.StatusCode
+		}()
+	}
+	wg.Wait()
+
+	for i, status := range statuses {
+		assert.Equal(t, http.StatusOK, status, "request %d", i)
+	}
+
+	var machines v1alpha1.MachineList
+	require.NoError(t, s.client.List(context.Background(), &machines))
+	ips := map[string]string{}
+	macs := map[string]bool{}
+	for _, m := range machines.Items {
+		if other, ok := ips[m.Spec.IP]; ok {
+			t.Errorf("%s and %s were both allocated %s", other, m.Name, m.Spec.IP)
+		}
+		ips[m.Spec.IP] = m.Name
+		macs[m.Spec.MAC] = true
+	}
+	assert.Len(t, macs, nodes)
+}
+
+func TestServer_coalesce(t *testing.T) {
+	s := NewServer(DefaultConfig())
+	release := make(chan struct{})
+	var renders atomic.Int32
+	handler := s.coalesce(func(w http.ResponseWriter, req *http.Request) {
+		renders.Add(1)
+		<-release
+		w.Header().Set("Content-Type", "application/yaml")
+		_, _ = w.Write([]byte(req.URL.Query().Get("mac")))
+	})
+
+	recorders := make([]*httptest.ResponseRecorder, 5)
+	var wg sync.WaitGroup
+	for i := range recorders {
+		recorders[i] = httptest.NewRecorder()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			handler(recorders[i], httptest.NewRequest(http.MethodGet, "/machineconfig/new?mac=52-54-00-12-34-56", nil))
+		}()
+	}
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.EqualValues(t, 1, renders.Load())
+	for _, rec := range recorders {
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "application/yaml", rec.Header().Get("Content-Type"))
+		assert.Equal(t, "52-54-00-12-34-56", rec.Body.String())
+	}
+
+	// Requests without hardware identifiers are rendered on their own.
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/machineconfig/new", nil))
+	assert.EqualValues(t, 2, renders.Load())
+}
+
+func TestServer_bounded(t *testing.T) {
+	conf := DefaultConfig()
+	conf.MaxConcurrentRenders = 1
+	conf.RenderQueueTimeout = 10 * time.Millisecond
+	s := NewServer(conf)
+
+	release := make(chan struct{})
+	entered := make(chan struct{})
+	handler := s.bounded(func(w http.ResponseWriter, _ *http.Request) {
+		close(entered)
+		<-release
+	})
+	go handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/machineconfig/new", nil))
+	<-entered
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/machineconfig/new", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, "10", rec.Header().Get("Retry-After"))
+	close(release)
+}
+
+func TestServer_rateLimit(t *testing.T) {
+	conf := DefaultConfig()
+	conf.RateLimit = 1
+	conf.RateLimitBurst = 1
+	s := NewServer(conf)
+	handler := WithMiddleware(s.rateLimit(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), rememberPeer, middleware.RealIP)
+
+	request := func(peer, forwardedFor string) int {
+		req := httptest.NewRequest(http.MethodGet, "/machineconfig/new", nil)
+		req.RemoteAddr = peer + ":41234"
+		if forwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", forwardedFor)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusOK, request("10.0.0.1", ""))
+	assert.Equal(t, http.StatusTooManyRequests, request("10.0.0.1", ""))
+	assert.Equal(t, http.StatusTooManyRequests, request("10.0.0.1", "192.168.0.1"), "forwarded addresses are not trusted")
+	assert.Equal(t, http.StatusOK, request("10.0.0.2", "10.0.0.1"))
+}
+
+func TestSourceLimiters(t *testing.T) {
+	l := newSourceLimiters(1, 2)
+	now := time.Now()
+
+	for range 2 {
+		_, ok := l.allow("10.0.0.1", now)
+		assert.True(t, ok)
+	}
+	after, ok := l.allow("10.0.0.1", now)
+	assert.False(t, ok)
+	assert.Equal(t, time.Second, after)
+
+	_, ok = l.allow("10.0.0.2", now)
+	assert.True(t, ok, "sources are limited independently")
+
+	_, ok = l.allow("10.0.0.1", now.Add(time.Second))
+	assert.True(t, ok)
+
+	// Buckets which refilled are dropped.
+	_, _ = l.allow("10.0.0.3", now.Add(time.Hour))
+	assert.Len(t, l.limiters, 1)
+}
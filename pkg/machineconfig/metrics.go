@@ -0,0 +1,172 @@
+package machineconfig
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/lukaspj/talos-cluster-operator/pkg/api/v1alpha1"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	metricsNamespace = "talos_machineconfig"
+	// unknownConfigLabel is the config name label of requests for patches which do not exist.
+	unknownConfigLabel = "unknown"
+)
+
+var (
+	renders = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "renders_total",
+		Help:      "Number of machine config requests by config name and outcome.",
+	}, []string{"config_name", "outcome"})
+
+	renderDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "render_duration_seconds",
+		Help:      "Duration of machine config requests by config name and outcome.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"config_name", "outcome"})
+
+	ipPoolSizeDesc = prometheus.NewDesc(metricsNamespace+"_ip_pool_addresses",
+		"Number of addresses in the machine CIDR.", []string{"cidr"}, nil)
+	ipPoolAllocatedDesc = prometheus.NewDesc(metricsNamespace+"_ip_pool_allocated",
+		"Number of addresses in the machine CIDR allocated to Machines.", []string{"cidr"}, nil)
+)
+
+func (s *Server) newMetricsRegistry() *prometheus.Registry {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	_ = s.registerMetrics(registry)
+
+	return registry
+}
+
+// registerMetrics registers the config server metrics, leaving the Go and process metrics to the registry owner.
+func (s *Server) registerMetrics(registry prometheus.Registerer) error {
+	for _, c := range []prometheus.Collector{renders, renderDuration, &ipPoolCollector{server: s}} {
+		if err := registry.Register(c); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// serveMetrics serves the metrics on the metrics address until the context is cancelled. "0" disables it.
+func (s *Server) serveMetrics(ctx context.Context) {
+	if s.Config.MetricsAddr == "" || s.Config.MetricsAddr == "0" {
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", promhttp.HandlerFor(s.metrics, promhttp.HandlerOpts{}))
+	srv := &http.Server{
+		Addr:    s.Config.MetricsAddr,
+		Handler: mux,
+	}
+	go func() {
+		<-ctx.Done()
+		_ = srv.Close()
+	}()
+
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		slog.Error("metrics server stopped", "error", err)
+	}
+}
+
+// instrumentRender records the outcome and duration of machine config requests.
+func (s *Server) instrumentRender(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, req.ProtoMajor)
+		next(ww, req)
+
+		configName := s.configLabel(req)
+		outcome := "success"
+		if ww.Status() >= http.StatusBadRequest {
+			outcome = "error"
+		}
+
+		renders.WithLabelValues(configName, outcome).Inc()
+		renderDuration.WithLabelValues(configName, outcome).Observe(time.Since(start).Seconds())
+	}
+}
+
+// configLabel returns the config name of the request as a label value. The name comes from the client, so names of
+// patches which do not exist are all recorded as "unknown" to bound the number of series.
+func (s *Server) configLabel(req *http.Request) string {
+	configName := req.PathValue("configName")
+	if configName == "" {
+		configName = defaultConfigName
+	}
+
+	namespace := s.namespace()
+	if ns := req.PathValue("namespace"); ns != "" {
+		if !slices.Contains(s.Config.Namespaces, ns) {
+			return unknownConfigLabel
+		}
+		namespace = ns
+	}
+	if s.client == nil {
+		return unknownConfigLabel
+	}
+	err := s.client.Get(context.WithoutCancel(req.Context()), types.NamespacedName{Namespace: namespace, Name: configName}, &corev1.ConfigMap{})
+	if err != nil {
+		return unknownConfigLabel
+	}
+
+	return configName
+}
+
+// ipPoolCollector reports the utilisation of the machine CIDR, computed from the Machines on every scrape.
+type ipPoolCollector struct {
+	server *Server
+}
+
+func (c *ipPoolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- ipPoolSizeDesc
+	ch <- ipPoolAllocatedDesc
+}
+
+func (c *ipPoolCollector) Collect(ch chan<- prometheus.Metric) {
+	if c.server.Config.MachineCIDR == "" || c.server.client == nil {
+		return
+	}
+	_, cidr, err := net.ParseCIDR(c.server.Config.MachineCIDR)
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var l v1alpha1.MachineList
+	if err := c.server.client.List(ctx, &l); err != nil {
+		slog.Error("unable to list machines for metrics", "error", err)
+		return
+	}
+
+	allocated := 0
+	for _, m := range l.Items {
+		if ip := net.ParseIP(m.Spec.IP); ip != nil && cidr.Contains(ip) {
+			allocated++
+		}
+	}
+	ones, bits := cidr.Mask.Size()
+
+	ch <- prometheus.MustNewConstMetric(ipPoolSizeDesc, prometheus.GaugeValue, float64(uint64(1)<<(bits-ones)), cidr.String())
+	ch <- prometheus.MustNewConstMetric(ipPoolAllocatedDesc, prometheus.GaugeValue, float64(allocated), cidr.String())
+}
@@ -0,0 +1,79 @@
+package machineconfig
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/lukaspj/talos-cluster-operator/pkg/api/v1alpha1"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestServer_instrumentRender(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, corev1.AddToScheme(scheme))
+
+	conf := DefaultConfig()
+	s := NewServer(conf)
+	s.client = fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "workers", Namespace: conf.Namespace}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "broken", Namespace: conf.Namespace}},
+	).Build()
+	handler := s.instrumentRender(func(w http.ResponseWriter, req *http.Request) {
+		if req.PathValue("configName") != "workers" || req.PathValue("namespace") != "" {
+			errorResponse(w, req, nil, "broken")
+		}
+	})
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /machineconfig/new/{configName}", handler)
+	mux.HandleFunc("GET /namespaces/{namespace}/machineconfig/new/{configName}", handler)
+
+	before := testutil.ToFloat64(renders.WithLabelValues("broken", "error"))
+	unknown := testutil.ToFloat64(renders.WithLabelValues(unknownConfigLabel, "error"))
+	for _, path := range []string{
+		"/machineconfig/new/workers",
+		"/machineconfig/new/broken",
+		"/machineconfig/new/made-up-1",
+		"/machineconfig/new/made-up-2",
+		"/namespaces/other/machineconfig/new/workers",
+	} {
+		mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	assert.Equal(t, before+1, testutil.ToFloat64(renders.WithLabelValues("broken", "error")))
+	assert.GreaterOrEqual(t, testutil.ToFloat64(renders.WithLabelValues("workers", "success")), 1.0)
+	assert.Equal(t, unknown+3, testutil.ToFloat64(renders.WithLabelValues(unknownConfigLabel, "error")),
+		"names of patches which do not exist are not used as label values")
+	assert.Zero(t, testutil.ToFloat64(renders.WithLabelValues("made-up-1", "error")))
+}
+
+func TestIPPoolCollector(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, v1alpha1.AddToScheme(scheme))
+
+	conf := DefaultConfig()
+	conf.MachineCIDR = "10.0.0.0/28"
+	s := NewServer(conf)
+	s.client = fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&v1alpha1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "a", Namespace: "machines"}, Spec: v1alpha1.MachineSpec{IP: "10.0.0.1"}},
+		&v1alpha1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "b", Namespace: "machines"}, Spec: v1alpha1.MachineSpec{IP: "10.0.0.2"}},
+		&v1alpha1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "c", Namespace: "machines"}, Spec: v1alpha1.MachineSpec{IP: "192.168.0.1"}},
+	).Build()
+
+	expected := `
+# HELP talos_machineconfig_ip_pool_addresses Number of addresses in the machine CIDR.
+# TYPE talos_machineconfig_ip_pool_addresses gauge
+talos_machineconfig_ip_pool_addresses{cidr="10.0.0.0/28"} 16
+# HELP talos_machineconfig_ip_pool_allocated Number of addresses in the machine CIDR allocated to Machines.
+# TYPE talos_machineconfig_ip_pool_allocated gauge
+talos_machineconfig_ip_pool_allocated{cidr="10.0.0.0/28"} 2
+`
+	assert.NoError(t, testutil.CollectAndCompare(&ipPoolCollector{server: s}, strings.NewReader(expected)))
+}
@@ -0,0 +1,86 @@
+package machineconfig
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// nameTemplateKey is the key of a patch ConfigMap overriding Config.MachineNameTemplate.
+const nameTemplateKey = "nameTemplate"
+
+// maxNameAttempts bounds the names tried before giving up on a template which keeps colliding.
+const maxNameAttempts = 10000
+
+// NameData is what machine name templates are rendered with.
+type NameData struct {
+	// Hostname, Serial, MAC and UUID identify the hardware as far as the request told.
+	Hostname string
+	Serial   string
+	MAC      string
+	UUID     string
+	// Labels are the labels of the patch ConfigMap, e.g. the rack the patch is written for.
+	Labels map[string]string
+	// Index counts up from 1 until the name is free, giving sequential names per prefix.
+	Index int
+	// Random is 8 random hex digits, drawn again for every attempt.
+	Random string
+}
+
+var nameFuncs = template.FuncMap{
+	"lower":   strings.ToLower,
+	"upper":   strings.ToUpper,
+	"replace": func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+	"trunc": func(n int, s string) string {
+		if len(s) > n {
+			return s[:n]
+		}
+		return s
+	},
+}
+
+// renderMachineName renders the name template into the first name not taken by an existing Machine. Templates
+// using neither Index nor Random render the same name on every attempt and fail on the first collision.
+func renderMachineName(text string, data NameData, taken func(name string) bool) (string, error) {
+	tmpl, err := template.New("name").Funcs(nameFuncs).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("parse machine name template: %w", err)
+	}
+
+	previous := ""
+	for index := 1; index <= maxNameAttempts; index++ {
+		data.Index = index
+		data.Random = randomHex(4)
+
+		var b bytes.Buffer
+		if err := tmpl.Execute(&b, data); err != nil {
+			return "", fmt.Errorf("render machine name template: %w", err)
+		}
+		name := b.String()
+		if errs := validation.IsDNS1123Label(name); len(errs) > 0 {
+			return "", badRequest(fmt.Errorf("machine name %q: %s", name, strings.Join(errs, ", ")))
+		}
+
+		if !taken(name) {
+			return name, nil
+		}
+		if name == previous {
+			break
+		}
+		previous = name
+	}
+
+	return "", conflict(errors.New("no free machine name for the name template"))
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
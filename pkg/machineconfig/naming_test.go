@@ -0,0 +1,53 @@
+package machineconfig
+
+import (
+	"net/http"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderMachineName(t *testing.T) {
+	existing := map[string]bool{"r12-node-1": true, "r12-node-2": true, "node-abc123": true}
+	taken := func(name string) bool { return existing[name] }
+	data := NameData{
+		Serial: "ABC123",
+		MAC:    "52:54:00:12:34:56",
+		Labels: map[string]string{"rack": "r12"},
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		want     string
+		status   int
+	}{
+		{name: "sequential per prefix", template: "{{ .Labels.rack }}-node-{{ .Index }}", want: "r12-node-3"},
+		{name: "hardware identifiers", template: `{{ .MAC | replace ":" "" }}`, want: "525400123456"},
+		{name: "collision", template: "node-{{ .Serial | lower }}", status: http.StatusConflict},
+		{name: "invalid name", template: "{{ .Serial }}", status: http.StatusBadRequest},
+		{name: "missing label", template: "{{ .Labels.row }}node-{{ .Index }}", want: "node-1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := renderMachineName(tt.template, data, taken)
+			if tt.status != 0 {
+				var statusErr *statusError
+				require.ErrorAs(t, err, &statusErr)
+				assert.Equal(t, tt.status, statusErr.status)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	got, err := renderMachineName(DefaultConfig().MachineNameTemplate, data, taken)
+	require.NoError(t, err)
+	assert.Regexp(t, regexp.MustCompile(`^nucas-node-[0-9a-f]{8}$`), got)
+
+	_, err = renderMachineName("{{ .Index", data, taken)
+	assert.ErrorContains(t, err, "parse machine name template")
+}
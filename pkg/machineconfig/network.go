@@ -0,0 +1,93 @@
+package machineconfig
+
+import (
+	"log/slog"
+	"net"
+	"slices"
+
+	talosv1alpha1 "github.com/siderolabs/talos/pkg/machinery/config/types/v1alpha1"
+)
+
+// bondInterface is the name of the bond created when Config.MachineBondMode is set.
+const bondInterface = "bond0"
+
+// applyStaticNetwork renders the network config of a machine allocated address from the machine CIDR into the first
+// interface of the patch, keeping whatever else the patch configures for it, such as its MTU, DHCP or VIP. The
+// interface is selected by the MAC address the machine booted with, or bonded when a bond mode is configured.
+// Without either, the interface of the patch is addressed as is.
+func (s *Server) applyStaticNetwork(network *talosv1alpha1.NetworkConfig, mac string, address *net.IPNet) {
+	for _, nameserver := range s.Config.MachineNameservers {
+		if !slices.Contains(network.NameServers, nameserver) {
+			network.NameServers = append(network.NameServers, nameserver)
+		}
+	}
+
+	device := &talosv1alpha1.Device{}
+	if len(network.NetworkInterfaces) > 0 {
+		device = network.NetworkInterfaces[0]
+	}
+	switch {
+	case s.Config.MachineBondMode != "":
+		selector := talosv1alpha1.NetworkDeviceSelector{NetworkDeviceKernelDriver: s.Config.MachineBondDriver}
+		if s.Config.MachineBondDriver == "" {
+			if mac == "" {
+				slog.Warn("not rendering static network config, the bond members are unknown", "address", address.String())
+				return
+			}
+			selector = talosv1alpha1.NetworkDeviceSelector{NetworkDeviceHardwareAddress: mac}
+		}
+		if device.DeviceBond == nil {
+			device.DeviceBond = &talosv1alpha1.Bond{}
+		}
+		device.DeviceInterface, device.DeviceSelector = bondInterface, nil
+		device.DeviceBond.BondMode = s.Config.MachineBondMode
+		device.DeviceBond.BondDeviceSelectors = []talosv1alpha1.NetworkDeviceSelector{selector}
+	case mac != "":
+		device.DeviceInterface = ""
+		device.DeviceSelector = &talosv1alpha1.NetworkDeviceSelector{NetworkDeviceHardwareAddress: mac}
+	case len(network.NetworkInterfaces) > 0:
+	default:
+		slog.Warn("not rendering static network config, the machine interface is unknown", "address", address.String())
+		return
+	}
+
+	var route *talosv1alpha1.Route
+	if s.Config.MachineGateway != "" {
+		route = &talosv1alpha1.Route{RouteNetwork: "0.0.0.0/0", RouteGateway: s.Config.MachineGateway}
+	}
+
+	if s.Config.MachineVLAN != 0 {
+		i := slices.IndexFunc(device.DeviceVlans, func(v *talosv1alpha1.Vlan) bool { return v.VlanID == uint16(s.Config.MachineVLAN) })
+		if i < 0 {
+			device.DeviceVlans = append(device.DeviceVlans, &talosv1alpha1.Vlan{VlanID: uint16(s.Config.MachineVLAN)})
+			i = len(device.DeviceVlans) - 1
+		}
+		vlan := device.DeviceVlans[i]
+		vlan.VlanAddresses = appendAddress(vlan.VlanAddresses, address.String())
+		vlan.VlanRoutes = appendRoute(vlan.VlanRoutes, route)
+	} else {
+		device.DeviceAddresses = appendAddress(device.DeviceAddresses, address.String())
+		device.DeviceRoutes = appendRoute(device.DeviceRoutes, route)
+	}
+
+	if len(network.NetworkInterfaces) == 0 {
+		network.NetworkInterfaces = talosv1alpha1.NetworkDeviceList{device}
+	}
+}
+
+func appendAddress(addresses []string, address string) []string {
+	if slices.Contains(addresses, address) {
+		return addresses
+	}
+
+	return append(addresses, address)
+}
+
+// appendRoute adds the route unless the patch already routes its network.
+func appendRoute(routes []*talosv1alpha1.Route, route *talosv1alpha1.Route) []*talosv1alpha1.Route {
+	if route == nil || slices.ContainsFunc(routes, func(r *talosv1alpha1.Route) bool { return r.RouteNetwork == route.RouteNetwork }) {
+		return routes
+	}
+
+	return append(routes, route)
+}
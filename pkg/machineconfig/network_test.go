@@ -0,0 +1,137 @@
+package machineconfig
+
+import (
+	"net"
+	"testing"
+
+	talosv1alpha1 "github.com/siderolabs/talos/pkg/machinery/config/types/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/utils/ptr"
+)
+
+func TestServer_applyStaticNetwork(t *testing.T) {
+	address := &net.IPNet{IP: net.ParseIP("10.0.1.5"), Mask: net.CIDRMask(24, 32)}
+	defaultRoute := []*talosv1alpha1.Route{{RouteNetwork: "0.0.0.0/0", RouteGateway: "10.0.1.1"}}
+	patchInterfaces := func() talosv1alpha1.NetworkDeviceList {
+		return talosv1alpha1.NetworkDeviceList{
+			{DeviceInterface: "eth0", DeviceDHCP: ptr.To(true)},
+			{DeviceInterface: "eth1", DeviceAddresses: []string{"192.168.0.5/24"}},
+		}
+	}
+
+	tests := []struct {
+		name       string
+		configure  func(c *Config)
+		mac        string
+		interfaces talosv1alpha1.NetworkDeviceList
+		want       talosv1alpha1.NetworkDeviceList
+	}{
+		{
+			name: "selected by MAC",
+			mac:  "52:54:00:12:34:56",
+			want: talosv1alpha1.NetworkDeviceList{{
+				DeviceSelector:  &talosv1alpha1.NetworkDeviceSelector{NetworkDeviceHardwareAddress: "52:54:00:12:34:56"},
+				DeviceAddresses: []string{"10.0.1.5/24"},
+				DeviceRoutes:    defaultRoute,
+			}},
+		},
+		{
+			name:       "selects the first patch interface by MAC",
+			mac:        "52:54:00:12:34:56",
+			interfaces: patchInterfaces(),
+			want: talosv1alpha1.NetworkDeviceList{
+				{
+					DeviceSelector:  &talosv1alpha1.NetworkDeviceSelector{NetworkDeviceHardwareAddress: "52:54:00:12:34:56"},
+					DeviceAddresses: []string{"10.0.1.5/24"},
+					DeviceRoutes:    defaultRoute,
+					DeviceDHCP:      ptr.To(true),
+				},
+				patchInterfaces()[1],
+			},
+		},
+		{
+			name:       "unknown MAC keeps the patch interface",
+			interfaces: patchInterfaces(),
+			want: talosv1alpha1.NetworkDeviceList{
+				{DeviceInterface: "eth0", DeviceAddresses: []string{"10.0.1.5/24"}, DeviceRoutes: defaultRoute, DeviceDHCP: ptr.To(true)},
+				patchInterfaces()[1],
+			},
+		},
+		{
+			name: "keeps the settings of the patch interface",
+			mac:  "52:54:00:12:34:56",
+			interfaces: talosv1alpha1.NetworkDeviceList{{
+				DeviceInterface: "eth0",
+				DeviceMTU:       9000,
+				DeviceAddresses: []string{"10.0.2.5/24"},
+				DeviceRoutes:    []*talosv1alpha1.Route{{RouteNetwork: "10.0.3.0/24", RouteGateway: "10.0.2.1"}},
+				DeviceVIPConfig: &talosv1alpha1.DeviceVIPConfig{SharedIP: "10.0.1.100"},
+			}},
+			want: talosv1alpha1.NetworkDeviceList{{
+				DeviceSelector:  &talosv1alpha1.NetworkDeviceSelector{NetworkDeviceHardwareAddress: "52:54:00:12:34:56"},
+				DeviceMTU:       9000,
+				DeviceAddresses: []string{"10.0.2.5/24", "10.0.1.5/24"},
+				DeviceRoutes: []*talosv1alpha1.Route{
+					{RouteNetwork: "10.0.3.0/24", RouteGateway: "10.0.2.1"},
+					{RouteNetwork: "0.0.0.0/0", RouteGateway: "10.0.1.1"},
+				},
+				DeviceVIPConfig: &talosv1alpha1.DeviceVIPConfig{SharedIP: "10.0.1.100"},
+			}},
+		},
+		{
+			name: "keeps the default route of the patch",
+			interfaces: talosv1alpha1.NetworkDeviceList{{
+				DeviceInterface: "eth0",
+				DeviceRoutes:    []*talosv1alpha1.Route{{RouteNetwork: "0.0.0.0/0", RouteGateway: "10.0.1.254"}},
+			}},
+			want: talosv1alpha1.NetworkDeviceList{{
+				DeviceInterface: "eth0",
+				DeviceAddresses: []string{"10.0.1.5/24"},
+				DeviceRoutes:    []*talosv1alpha1.Route{{RouteNetwork: "0.0.0.0/0", RouteGateway: "10.0.1.254"}},
+			}},
+		},
+		{
+			name: "unknown interface",
+		},
+		{
+			name:      "bonded VLAN",
+			configure: func(c *Config) { c.MachineBondMode, c.MachineBondDriver, c.MachineVLAN = "802.3ad", "mlx5_core", 120 },
+			want: talosv1alpha1.NetworkDeviceList{{
+				DeviceInterface: "bond0",
+				DeviceBond: &talosv1alpha1.Bond{
+					BondMode:            "802.3ad",
+					BondDeviceSelectors: []talosv1alpha1.NetworkDeviceSelector{{NetworkDeviceKernelDriver: "mlx5_core"}},
+				},
+				DeviceVlans: talosv1alpha1.VlanList{{VlanID: 120, VlanAddresses: []string{"10.0.1.5/24"}, VlanRoutes: defaultRoute}},
+			}},
+		},
+		{
+			name:      "merges into the VLAN of the patch",
+			configure: func(c *Config) { c.MachineVLAN = 120 },
+			interfaces: talosv1alpha1.NetworkDeviceList{{
+				DeviceInterface: "eth0",
+				DeviceVlans:     talosv1alpha1.VlanList{{VlanID: 120, VlanMTU: 1400}},
+			}},
+			want: talosv1alpha1.NetworkDeviceList{{
+				DeviceInterface: "eth0",
+				DeviceVlans:     talosv1alpha1.VlanList{{VlanID: 120, VlanMTU: 1400, VlanAddresses: []string{"10.0.1.5/24"}, VlanRoutes: defaultRoute}},
+			}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := DefaultConfig()
+			conf.MachineGateway = "10.0.1.1"
+			conf.MachineNameservers = []string{"10.0.0.53"}
+			if tt.configure != nil {
+				tt.configure(&conf)
+			}
+
+			network := &talosv1alpha1.NetworkConfig{NetworkInterfaces: tt.interfaces, NameServers: []string{"1.1.1.1"}}
+			NewServer(conf).applyStaticNetwork(network, tt.mac, address)
+
+			assert.Equal(t, tt.want, network.NetworkInterfaces)
+			assert.Equal(t, []string{"1.1.1.1", "10.0.0.53"}, network.NameServers)
+		})
+	}
+}
@@ -2,46 +2,168 @@ package machineconfig
 
 import (
 	"context"
-	"crypto/rand"
+	"crypto/sha256"
 	"fmt"
 	"log/slog"
 	"net"
 	"net/http"
 	"os"
-	"path/filepath"
+	"slices"
+	"sync"
+	"time"
 
 	"github.com/cosi-project/runtime/pkg/resource"
-	"github.com/cosi-project/runtime/pkg/state"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/lukaspj/talos-cluster-operator/pkg/api/v1alpha1"
-	talosctl "github.com/siderolabs/talos/pkg/machinery/client"
+	"github.com/lukaspj/talos-cluster-operator/pkg/talosclient"
+	"github.com/lukaspj/talos-cluster-operator/pkg/tracing"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/siderolabs/talos/pkg/machinery/config/generate"
 	"github.com/siderolabs/talos/pkg/machinery/config/machine"
 	talosv1alpha1 "github.com/siderolabs/talos/pkg/machinery/config/types/v1alpha1"
 	"github.com/siderolabs/talos/pkg/machinery/constants"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	yaml "go.yaml.in/yaml/v4"
+	"golang.org/x/sync/singleflight"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/rest"
-	"k8s.io/client-go/tools/clientcmd"
-	"k8s.io/client-go/util/homedir"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
 )
 
+// FieldOwner is the field manager used for every write the config server makes.
+const FieldOwner = "talos-machineconfig-server"
+
 type Middleware func(http.Handler) http.Handler
 
 type Server struct {
 	Config Config
+
+	kube      kubernetes.Interface
+	client    client.Client
+	cache     cache.Cache
+	talos     *talosclient.Pool
+	cluster   clusterSource
+	hints     *hintStore
+	allocator *allocator
+	// renderSlots bounds the renders in flight, see Config.MaxConcurrentRenders.
+	renderSlots chan struct{}
+	limiters    *sourceLimiters
+	inflight    singleflight.Group
+	// placeholderInput generates the input configs are rendered from once. Its secrets are all replaced by those of
+	// the management cluster.
+	placeholderInput func() (*generate.Input, error)
+	metrics          *prometheus.Registry
+	audit            *auditQueue
+	// managed is set when the server runs inside the operator manager, which runs the Talos client pool and serves
+	// the metrics.
+	managed bool
 }
 
 func NewServer(conf Config) *Server {
-	return &Server{
-		Config: conf,
+	s := newServer(conf)
+	s.metrics = s.newMetricsRegistry()
+
+	return s
+}
+
+// NewManagedServer returns a server to run as a Runnable of the operator manager. It reads through the manager's
+// client and cache, which must be created with the options of Config.CacheByObject, and takes Talos clients from the
+// operator's pool.
+func NewManagedServer(conf Config, mgr manager.Manager, talos *talosclient.Pool) (*Server, error) {
+	kube, err := kubernetes.NewForConfig(mgr.GetConfig())
+	if err != nil {
+		return nil, err
+	}
+	if err := registerInformers(mgr.GetCache()); err != nil {
+		return nil, err
 	}
+
+	s := newServer(conf)
+	s.kube = kube
+	s.client = mgr.GetClient()
+	s.talos = talos
+	s.managed = true
+	if err := s.registerMetrics(metrics.Registry); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func newServer(conf Config) *Server {
+	s := &Server{
+		Config:    conf,
+		hints:     newHintStore(conf.BootHintTTL),
+		allocator: newAllocator(),
+	}
+	s.cluster = &talosCluster{server: s}
+	s.placeholderInput = sync.OnceValues(func() (*generate.Input, error) {
+		return generate.NewInput("_placeholder", "1.2.3.4", constants.DefaultKubernetesVersion)
+	})
+	if conf.MaxConcurrentRenders > 0 {
+		s.renderSlots = make(chan struct{}, conf.MaxConcurrentRenders)
+	}
+	if conf.RateLimit > 0 {
+		s.limiters = newSourceLimiters(conf.RateLimit, conf.RateLimitBurst)
+	}
+
+	return s
+}
+
+// NeedLeaderElection lets every operator replica serve machine configs, not only the leader. Addresses are claimed
+// on the API server, so replicas do not hand out the same one.
+func (s *Server) NeedLeaderElection() bool {
+	return false
 }
 
 func (s *Server) Start(ctx context.Context) error {
+	if err := s.initClients(); err != nil {
+		return err
+	}
+	sinks, err := s.auditSinks()
+	if err != nil {
+		slog.Error("unable to set up audit sinks", "error", err)
+		return err
+	}
+	s.audit = newAuditQueue(sinks)
+	go s.audit.run(ctx)
+
+	if s.cache != nil {
+		go func() {
+			if err := s.cache.Start(ctx); err != nil {
+				slog.Error("informer cache stopped", "error", err)
+			}
+		}()
+	}
+	if !s.managed {
+		go func() {
+			if err := s.talos.Start(ctx); err != nil {
+				slog.Error("unable to close talos clients", "error", err)
+			}
+		}()
+
+		go s.serveMetrics(ctx)
+	}
+
+	if s.Config.ProxyDHCPEnabled {
+		dhcp, err := s.proxyDHCP()
+		if err != nil {
+			slog.Error("unable to start proxy dhcp", "error", err)
+			return err
+		}
+		go func() {
+			if err := dhcp.Serve(ctx); err != nil {
+				slog.Error("proxy dhcp stopped", "error", err)
+			}
+		}()
+	}
+
 	srv := http.Server{
 		Addr: fmt.Sprintf(":%d", s.Config.Port),
 		BaseContext: func(listener net.Listener) context.Context {
@@ -49,20 +171,36 @@ func (s *Server) Start(ctx context.Context) error {
 		},
 		Handler: s.Routes(),
 	}
+	go func() {
+		<-ctx.Done()
+		_ = srv.Shutdown(context.Background())
+	}()
 
-	return srv.ListenAndServe()
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+
+	return nil
 }
 
 func (s *Server) Routes() http.Handler {
 	mux := http.NewServeMux()
 
 	mux.HandleFunc("GET /readyz", s.Readyz)
+	mux.HandleFunc("GET /readyz/{check}", s.Readyz)
 	mux.HandleFunc("GET /livez", s.Livez)
 
-	mux.HandleFunc("GET /machineconfig/new", s.NewMachineConfig)
-	mux.HandleFunc("GET /machineconfig/new/{configName}", s.NewMachineConfig)
+	render := s.instrumentRender(s.limitRender(s.NewMachineConfig))
+	mux.HandleFunc("GET /machineconfig/new", render)
+	mux.HandleFunc("GET /machineconfig/new/{configName}", render)
+	mux.HandleFunc("GET /namespaces/{namespace}/machineconfig/new", render)
+	mux.HandleFunc("GET /namespaces/{namespace}/machineconfig/new/{configName}", render)
+
+	if s.Config.BootEnabled {
+		s.bootRoutes(mux)
+	}
 
-	return WithMiddleware(mux, middleware.RealIP, middleware.StripSlashes, middleware.Recoverer, middleware.RequestID)
+	return WithMiddleware(mux, rememberPeer, middleware.RealIP, middleware.StripSlashes, middleware.Recoverer, middleware.RequestID, traceRequests)
 }
 
 func WithMiddleware(h http.Handler, m ...Middleware) http.Handler {
@@ -73,14 +211,6 @@ func WithMiddleware(h http.Handler, m ...Middleware) http.Handler {
 	return h
 }
 
-func (s *Server) Readyz(w http.ResponseWriter, _ *http.Request) {
-	w.WriteHeader(http.StatusOK)
-}
-
-func (s *Server) Livez(w http.ResponseWriter, _ *http.Request) {
-	w.WriteHeader(http.StatusOK)
-}
-
 func (s *Server) NewMachineConfig(w http.ResponseWriter, req *http.Request) {
 	uuid := req.URL.Query().Get("uuid")
 	serial := req.URL.Query().Get("serial")
@@ -89,153 +219,134 @@ func (s *Server) NewMachineConfig(w http.ResponseWriter, req *http.Request) {
 	configName := req.PathValue("configName")
 
 	if configName == "" {
-		configName = "default-machine-config"
+		configName = defaultConfigName
 	}
 
-	slog.Info("new machine config request", "uuid", uuid, "serial", serial, "mac", mac, "hostname", hostname, "configName", configName)
-
-	ns, err := os.ReadFile("/var/run/secrets/kubernetes.io/serviceaccount/namespace")
-	if err != nil {
-		slog.Error("could not read current namespace, using default", "error", err)
-		ns = []byte(s.Config.Namespace)
-	}
-
-	ctx := req.Context()
-
-	clusterConfig, err := rest.InClusterConfig()
-	if err != nil {
-		slog.Error("failed to get in-cluster configuration", "error", err)
-
-		var kubeconfig string
-		if home := homedir.HomeDir(); home != "" {
-			kubeconfig = filepath.Join(home, ".kube", "config")
-		}
-
-		// use the current context in kubeconfig
-		clusterConfig, err = clientcmd.BuildConfigFromFlags("", kubeconfig)
-		if err != nil {
-			errorResponse(w, err, "failed to get kubernetes client configuration", http.StatusInternalServerError)
+	patchNamespace, machineNamespace := s.namespace(), s.Config.MachineNamespace
+	if ns := req.PathValue("namespace"); ns != "" {
+		if !slices.Contains(s.Config.Namespaces, ns) {
+			errorResponse(w, req, notFound(nil), "unknown namespace")
 			return
 		}
+		patchNamespace, machineNamespace = ns, ns
 	}
-	clientset, err := kubernetes.NewForConfig(clusterConfig)
-	if err != nil {
-		errorResponse(w, err, "failed to initialise Kubernetes client", http.StatusInternalServerError)
-		return
+
+	if hw, err := net.ParseMAC(mac); err == nil {
+		mac = hw.String()
+	} else {
+		mac = ""
 	}
+	if hint, ok := s.hints.Lookup(mac, uuid); ok {
+		slog.Info("correlated machine config request with network boot", "mac", hint.MAC, "uuid", uuid, "arch", hint.Arch, "seen", hint.Seen)
+		mac = hint.MAC
+	}
+
+	slog.Info("new machine config request", "uuid", uuid, "serial", serial, "mac", mac, "hostname", hostname, "configName", configName, "namespace", machineNamespace)
+
+	ctx := req.Context()
 
-	configMap, err := clientset.CoreV1().ConfigMaps(string(ns)).Get(ctx, configName, metav1.GetOptions{})
+	spanCtx, span := tracer.Start(ctx, "get machine patch", trace.WithAttributes(
+		attribute.String("namespace", patchNamespace), attribute.String("config_name", configName)))
+	var configMap corev1.ConfigMap
+	err := s.client.Get(spanCtx, types.NamespacedName{Namespace: patchNamespace, Name: configName}, &configMap)
+	tracing.End(span, err)
 	if err != nil {
-		errorResponse(w, err, "could not get machine patch", http.StatusInternalServerError)
+		errorResponse(w, req, kubeError(err), "could not get machine patch")
 		return
 	}
 
 	var configPatch talosv1alpha1.Config
 	err = yaml.Unmarshal([]byte(configMap.Data["machineconfig"]), &configPatch)
 	if err != nil {
-		errorResponse(w, err, "could not unmarshal machine patch", http.StatusInternalServerError)
+		errorResponse(w, req, err, "could not unmarshal machine patch")
 		return
 	}
 
-	ctl, err := talosctl.New(ctx, talosctl.WithConfigFromFile(s.Config.TalosConfigPath))
+	spanCtx, span = tracer.Start(ctx, "resolve installer image")
+	installerImage, err := s.installerImage(spanCtx, configName, machineNamespace)
+	tracing.End(span, err)
 	if err != nil {
-		errorResponse(w, err, "could not initialise talosctl", http.StatusInternalServerError)
+		errorResponse(w, req, err, "failed to resolve installer image")
 		return
 	}
 
-	talosNamespace := "config"
-	resourceKind, err := ctl.ResolveResourceKind(ctx, &talosNamespace, "machineconfig")
+	machineConfig, secretsVersion, err := s.cluster.MachineConfig(ctx)
 	if err != nil {
-		errorResponse(w, err, "could not get talos machine config kind", http.StatusInternalServerError)
+		errorResponse(w, req, err, "could not get talos machine config")
 		return
 	}
 
-	r, err := ctl.COSI.Get(ctx, resource.NewMetadata(talosNamespace, resourceKind.TypedSpec().Type, "v1alpha1", resource.VersionUndefined),
-		state.WithGetUnmarshalOptions(state.WithSkipProtobufUnmarshal()))
+	input, err := s.placeholderInput()
 	if err != nil {
-		errorResponse(w, err, "could not get talos machine config spec", http.StatusInternalServerError)
+		errorResponse(w, req, err, "failed to set new input")
 		return
 	}
 
-	conf, err := yaml.Marshal(r.Spec())
-	if err != nil {
-		errorResponse(w, err, "could not marshal talos machine config spec", http.StatusInternalServerError)
-		return
-	}
-	var machineConfig talosv1alpha1.Config
-	slog.Info("machine config spec", "conf", string(conf))
-	err = yaml.Unmarshal(conf, &machineConfig)
+	config, err := input.Config(machine.TypeWorker)
 	if err != nil {
-		errorResponse(w, err, "could not unmarshal talos machine config spec", http.StatusInternalServerError)
+		errorResponse(w, req, err, "failed to generate config")
 		return
 	}
 
-	input, err := generate.NewInput("_placeholder", "1.2.3.4", constants.DefaultKubernetesVersion)
+	var l v1alpha1.MachineList
+	spanCtx, span = tracer.Start(ctx, "list machines")
+	err = s.client.List(spanCtx, &l)
+	tracing.End(span, err)
 	if err != nil {
-		errorResponse(w, err, "failed to set new input", http.StatusInternalServerError)
+		errorResponse(w, req, err, "failed to list machines")
 		return
 	}
 
-	config, err := input.Config(machine.TypeWorker)
+	nameTemplate := s.Config.MachineNameTemplate
+	if t, ok := configMap.Data[nameTemplateKey]; ok {
+		nameTemplate = t
+	}
+	spanCtx, span = tracer.Start(ctx, "allocate machine")
+	machineIP, machineName, err := s.allocateMachine(spanCtx, l.Items, machineNamespace,
+		func(taken func(name string) bool) (string, error) {
+			return renderMachineName(nameTemplate, NameData{
+				Hostname: hostname,
+				Serial:   serial,
+				MAC:      mac,
+				UUID:     uuid,
+				Labels:   configMap.Labels,
+			}, taken)
+		})
+	tracing.End(span, err)
 	if err != nil {
-		errorResponse(w, err, "failed to generate config", http.StatusInternalServerError)
+		errorResponse(w, req, kubeError(err), "failed to allocate machine")
 		return
 	}
 
-	scheme := runtime.NewScheme()
-	if err := v1alpha1.AddToScheme(scheme); err != nil {
-		errorResponse(w, err, "unable to add to scheme", http.StatusInternalServerError)
-		return
+	// Reserve the name and address before rendering. The Machine stays pending until the operator sees the node
+	// report in on its address, and is rolled back when the config does not make it to the node.
+	// The MAC address is recorded so the boot service boots the machine from its disk from now on.
+	m := &v1alpha1.Machine{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      machineName,
+			Namespace: machineNamespace,
+		},
+		Spec: v1alpha1.MachineSpec{
+			IP:   machineIP.IP.String(),
+			Port: 50000,
+			MAC:  mac,
+		},
+		Status: v1alpha1.MachineStatus{InstallerImage: installerImage},
 	}
-	c, _ := client.New(clusterConfig, client.Options{Scheme: scheme})
-	var l v1alpha1.MachineList
-	err = c.List(ctx, &l)
+	spanCtx, span = tracer.Start(ctx, "reserve machine", trace.WithAttributes(
+		attribute.String("namespace", machineNamespace), attribute.String("machine", machineName), attribute.String("ip", m.Spec.IP)))
+	err = s.reserveMachine(spanCtx, m)
+	tracing.End(span, err)
 	if err != nil {
-		errorResponse(w, err, "failed to list machines", http.StatusInternalServerError)
+		errorResponse(w, req, kubeError(err), "failed to reserve machine")
 		return
 	}
-
-	machineIP := &net.IPNet{
-		Mask: net.CIDRMask(s.Config.MachineSubnetSize, 32),
-	}
-	if s.Config.MachineCIDR != "" {
-		_, cidr, err := net.ParseCIDR(s.Config.MachineCIDR)
-		if err != nil {
-			errorResponse(w, err, "failed to parse machine CIDR", http.StatusInternalServerError)
-			return
-		}
-		machineIP.IP = cidr.IP
-		for {
-			matched := false
-			for _, m := range l.Items {
-				ip := net.ParseIP(m.Spec.IP)
-				if ip == nil {
-					continue
-				}
-				if !cidr.Contains(ip) {
-					continue
-				}
-				if machineIP.IP.Equal(ip) {
-					matched = true
-					machineIP.IP = nextIP(machineIP.IP, 1)
-
-					break
-				}
-			}
-			if cidr.Contains(machineIP.IP) && matched {
-				continue
-			}
-			if !cidr.Contains(machineIP.IP) {
-				errorResponse(w, err, "no more IPs available in CIDR", http.StatusInternalServerError)
-				return
-			}
-			break
+	issued := false
+	defer func() {
+		if !issued {
+			s.rollback(ctx, m)
 		}
-	}
-
-	b := make([]byte, 4)
-	_, _ = rand.Read(b)
-	machineName := fmt.Sprintf("nucas-node-%x", b)
+	}()
 
 	config, err = config.PatchV1Alpha1(func(config *talosv1alpha1.Config) error {
 		err = yaml.Unmarshal([]byte(configMap.Data["machineconfig"]), &config)
@@ -243,11 +354,19 @@ func (s *Server) NewMachineConfig(w http.ResponseWriter, req *http.Request) {
 			return err
 		}
 
+		if config.MachineConfig.MachineNetwork == nil {
+			config.MachineConfig.MachineNetwork = &talosv1alpha1.NetworkConfig{}
+		}
 		config.MachineConfig.MachineNetwork.NetworkHostname = machineName
-		if len(config.MachineConfig.MachineNetwork.NetworkInterfaces) > 0 && machineIP != nil {
-			config.MachineConfig.MachineNetwork.NetworkInterfaces[0].DeviceAddresses = []string{
-				machineIP.String(),
+		if machineIP.IP != nil {
+			s.applyStaticNetwork(config.MachineConfig.MachineNetwork, mac, machineIP)
+		}
+
+		if installerImage != "" {
+			if config.MachineConfig.MachineInstall == nil {
+				config.MachineConfig.MachineInstall = &talosv1alpha1.InstallConfig{}
 			}
+			config.MachineConfig.MachineInstall.InstallImage = installerImage
 		}
 
 		config.MachineConfig.MachineToken = machineConfig.MachineConfig.MachineToken
@@ -263,42 +382,133 @@ func (s *Server) NewMachineConfig(w http.ResponseWriter, req *http.Request) {
 		return nil
 	})
 	if err != nil {
-		errorResponse(w, err, "failed to patch config", http.StatusInternalServerError)
+		errorResponse(w, req, err, "failed to patch config")
 		return
 	}
 
 	bs, err := config.Bytes()
 	if err != nil {
-		errorResponse(w, err, "failed to serialize config", http.StatusInternalServerError)
+		errorResponse(w, req, err, "failed to serialize config")
+		return
+	}
+	redactedConfig, err := config.RedactSecrets(redacted).Bytes()
+	if err != nil {
+		errorResponse(w, req, err, "failed to redact config")
 		return
 	}
 
-	err = c.Create(ctx, &v1alpha1.Machine{
+	// The rendered config is kept as the desired config the operator detects drift against. It holds the secrets of
+	// the management cluster, so it is kept in our namespace rather than the Machine's.
+	configSecret := &corev1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      machineName,
-			Namespace: "machines",
+			Name:      m.DesiredConfigSecretName(),
+			Namespace: s.namespace(),
 		},
-		Spec: v1alpha1.MachineSpec{
-			IP:   machineIP.IP.String(),
-			Port: 50000,
-		},
-	})
+		Data: map[string][]byte{"config": bs},
+	}
+	spanCtx, span = tracer.Start(ctx, "store machine config")
+	err = s.client.Create(spanCtx, configSecret, client.FieldOwner(FieldOwner))
+	tracing.End(span, err)
 	if err != nil {
-		errorResponse(w, err, "failed to create machine", http.StatusInternalServerError)
+		errorResponse(w, req, kubeError(err), "failed to store machine config")
 		return
 	}
 
-	_, err = w.Write(bs)
-	if err != nil {
-		errorResponse(w, err, "failed to write config", http.StatusInternalServerError)
+	if err := ctx.Err(); err != nil {
+		slog.Warn("client went away before the config was written", "machine", machineName, "error", err)
+		return
+	}
+	if _, err := w.Write(bs); err != nil {
+		slog.Error("failed to write config", "machine", machineName, "error", err)
 		return
 	}
+	issued = true
+	s.hints.Forget(mac)
+
+	s.recordAudit(ctx, m, AuditRecord{
+		Time:           time.Now(),
+		RequestID:      middleware.GetReqID(ctx),
+		RemoteAddr:     req.RemoteAddr,
+		UUID:           uuid,
+		Serial:         serial,
+		MAC:            mac,
+		Hostname:       hostname,
+		Patches:        []string{fmt.Sprintf("%s/%s@%s", configMap.Namespace, configMap.Name, configMap.ResourceVersion)},
+		Namespace:      machineNamespace,
+		Machine:        machineName,
+		IP:             m.Spec.IP,
+		ConfigSHA256:   fmt.Sprintf("%x", sha256.Sum256(bs)),
+		SecretsVersion: secretsVersion,
+		Config:         string(redactedConfig),
+	})
+}
+
+// reserveMachine creates the Machine in the pending phase, with the status it was given. The address claim is
+// released when the Machine cannot be created.
+func (s *Server) reserveMachine(ctx context.Context, m *v1alpha1.Machine) error {
+	status := m.Status
+	if err := s.client.Create(ctx, m, client.FieldOwner(FieldOwner)); err != nil {
+		s.releaseIP(ctx, m)
+		return err
+	}
+
+	base := m.DeepCopy()
+	m.Status = status
+	m.Status.Phase = v1alpha1.MachinePhasePending
+	if err := s.client.Status().Patch(ctx, m, client.MergeFrom(base), client.FieldOwner(FieldOwner)); err != nil {
+		s.rollback(ctx, m)
+		return err
+	}
+
+	return nil
 }
 
-func errorResponse(w http.ResponseWriter, err error, msg string, code int) {
-	w.WriteHeader(code)
-	slog.Error(msg, "error", err)
-	_, _ = w.Write([]byte(msg))
+// rollback deletes a Machine whose config was not handed out, releasing its name and address, along with its address
+// claim and config Secret. It runs even when the request was cancelled.
+func (s *Server) rollback(ctx context.Context, m *v1alpha1.Machine) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancel()
+
+	s.allocator.release(m)
+	s.releaseIP(ctx, m)
+	configSecret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: m.DesiredConfigSecretName(), Namespace: s.namespace()}}
+	if err := s.client.Delete(ctx, configSecret); client.IgnoreNotFound(err) != nil {
+		slog.Error("unable to delete config of rolled back machine", "machine", m.Name, "error", err)
+	}
+	if err := s.client.Delete(ctx, m); client.IgnoreNotFound(err) != nil {
+		slog.Error("unable to roll back machine registration, the operator deletes it once it expires", "machine", m.Name, "error", err)
+		return
+	}
+	slog.Info("rolled back machine registration", "machine", m.Name)
+}
+
+// recordAudit queues the record for the audit sinks.
+func (s *Server) recordAudit(ctx context.Context, m *v1alpha1.Machine, record AuditRecord) {
+	if s.audit != nil {
+		s.audit.enqueue(ctx, m, record)
+	}
+}
+
+// namespace returns the namespace the server runs in, falling back to the configured namespace.
+func (s *Server) namespace() string {
+	ns, err := os.ReadFile("/var/run/secrets/kubernetes.io/serviceaccount/namespace")
+	if err != nil {
+		slog.Error("could not read current namespace, using default", "error", err)
+		return s.Config.Namespace
+	}
+
+	return string(ns)
+}
+
+// talosCredentials returns the talosconfig used to read the management cluster's machine config. It is read from
+// the configured Secret on every call so rotations take effect without a restart, unless only a file path is set.
+func (s *Server) talosCredentials(ctx context.Context) (talosclient.Credentials, error) {
+	if s.Config.TalosConfigSecretName == "" {
+		return talosclient.FileCredentials(s.Config.TalosConfigPath), nil
+	}
+
+	return talosclient.LoadSecretCredentials(ctx, s.client,
+		types.NamespacedName{Namespace: s.namespace(), Name: s.Config.TalosConfigSecretName}, s.Config.TalosConfigSecretKey)
 }
 
 type mcYamlRepr struct{ resource.Resource }
@@ -0,0 +1,115 @@
+package machineconfig
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lukaspj/talos-cluster-operator/pkg/api/v1alpha1"
+	"github.com/siderolabs/talos/pkg/machinery/config/configloader"
+	"github.com/siderolabs/talos/pkg/machinery/config/machine"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestServer_reserveMachine(t *testing.T) {
+	ctx := context.Background()
+
+	scheme := runtime.NewScheme()
+	require.NoError(t, v1alpha1.AddToScheme(scheme))
+
+	s := NewServer(DefaultConfig())
+	s.client = fake.NewClientBuilder().WithScheme(scheme).WithStatusSubresource(&v1alpha1.Machine{}).Build()
+
+	m := &v1alpha1.Machine{
+		ObjectMeta: metav1.ObjectMeta{Name: "nucas-node-1", Namespace: "machines"},
+		Spec:       v1alpha1.MachineSpec{IP: "10.0.0.1"},
+		Status:     v1alpha1.MachineStatus{InstallerImage: "factory.talos.dev/installer/abc:v1.11.3"},
+	}
+	require.NoError(t, s.reserveMachine(ctx, m))
+
+	got := &v1alpha1.Machine{}
+	require.NoError(t, s.client.Get(ctx, client.ObjectKeyFromObject(m), got))
+	assert.Equal(t, v1alpha1.MachinePhasePending, got.Status.Phase)
+	assert.Equal(t, "factory.talos.dev/installer/abc:v1.11.3", got.Status.InstallerImage)
+
+	// A second request picking the same name must not take over the reservation.
+	err := s.reserveMachine(ctx, &v1alpha1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "nucas-node-1", Namespace: "machines"}})
+	assert.True(t, k8serrors.IsAlreadyExists(err))
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	s.rollback(cancelled, m)
+	assert.True(t, k8serrors.IsNotFound(s.client.Get(ctx, client.ObjectKeyFromObject(m), got)))
+}
+
+func TestServer_NewMachineConfig(t *testing.T) {
+	ctx := context.Background()
+
+	scheme := runtime.NewScheme()
+	require.NoError(t, corev1.AddToScheme(scheme))
+	require.NoError(t, coordinationv1.AddToScheme(scheme))
+	require.NoError(t, v1alpha1.AddToScheme(scheme))
+
+	const image = "factory.talos.dev/installer/abc:v1.11.3"
+	conf := DefaultConfig()
+	conf.MachineCIDR = "10.0.0.0/24"
+	conf.MachineNamespace = "machines"
+	s := NewServer(conf)
+	input, err := s.placeholderInput()
+	require.NoError(t, err)
+	controlPlane, err := input.Config(machine.TypeControlPlane)
+	require.NoError(t, err)
+	s.cluster = &staticCluster{config: controlPlane.RawV1Alpha1()}
+	s.client = fake.NewClientBuilder().WithScheme(scheme).WithStatusSubresource(&v1alpha1.Machine{}).
+		WithObjects(
+			&corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "workers", Namespace: conf.Namespace},
+				Data:       map[string]string{"machineconfig": "machine:\n  type: worker\n"},
+			},
+			&v1alpha1.Cluster{
+				ObjectMeta: metav1.ObjectMeta{Name: "c1", Namespace: "clusters"},
+				Spec: v1alpha1.ClusterSpec{
+					Nodes:            v1alpha1.MachineSet{Name: "control-plane", Config: "control-plane"},
+					WorkerSets:       []v1alpha1.MachineSet{{Name: "workers", Config: "workers"}},
+					MachineNamespace: "machines",
+				},
+				Status: v1alpha1.ClusterStatus{MachineSets: []v1alpha1.MachineSetStatus{{Name: "workers", InstallerImage: image}}},
+			},
+		).Build()
+	srv := httptest.NewServer(s.Routes())
+	t.Cleanup(srv.Close)
+
+	res, err := http.Get(srv.URL + "/machineconfig/new/workers?mac=52:54:00:12:34:56")
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+
+	rendered, err := configloader.NewFromBytes(body)
+	require.NoError(t, err)
+	assert.Equal(t, image, rendered.Machine().Install().Image())
+
+	var machines v1alpha1.MachineList
+	require.NoError(t, s.client.List(ctx, &machines))
+	require.Len(t, machines.Items, 1)
+	assert.Equal(t, image, machines.Items[0].Status.InstallerImage, "the machine is not upgraded to the image it installed")
+
+	// The rendered config carries the cluster secrets and stays out of the Machine's namespace.
+	var secrets corev1.SecretList
+	require.NoError(t, s.client.List(ctx, &secrets))
+	require.Len(t, secrets.Items, 1)
+	assert.Equal(t, conf.Namespace, secrets.Items[0].Namespace)
+	assert.Equal(t, machines.Items[0].DesiredConfigSecretName(), secrets.Items[0].Name)
+	assert.Nil(t, machines.Items[0].Spec.ConfigSecretRef)
+}
@@ -0,0 +1,48 @@
+package machineconfig
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/lukaspj/talos-cluster-operator/pkg/machineconfig")
+
+// traceRequests starts a span for every request, continuing a trace propagated by the caller. It has to run after
+// middleware.RequestID so the request ID can be attached.
+func traceRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+		ctx, span := tracer.Start(ctx, req.Method+" "+req.URL.Path,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", req.Method),
+				attribute.String("url.path", req.URL.Path),
+				attribute.String("client.address", req.RemoteAddr),
+				attribute.String("request_id", middleware.GetReqID(ctx)),
+			))
+		defer span.End()
+
+		ww := middleware.NewWrapResponseWriter(w, req.ProtoMajor)
+		req = req.WithContext(ctx)
+		next.ServeHTTP(ww, req)
+
+		// The mux sets the matched pattern on the request it was handed, which keeps the span names bounded.
+		if req.Pattern != "" {
+			span.SetName(req.Pattern)
+		}
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		span.SetAttributes(attribute.Int("http.response.status_code", status))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	})
+}
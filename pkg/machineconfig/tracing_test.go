@@ -0,0 +1,40 @@
+package machineconfig
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTraceRequests(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	srv := newBootServer(t)
+
+	code, _ := get(t, srv.URL+"/boot/52:54:00:12:34:56/ipxe")
+	require.Equal(t, http.StatusOK, code)
+	code, _ = get(t, srv.URL+"/boot/assets/amd64/missing")
+	require.Equal(t, http.StatusNotFound, code)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+
+	assert.Equal(t, "GET /boot/{mac}/ipxe", spans[0].Name())
+	attrs := attribute.NewSet(spans[0].Attributes()...)
+	requestID, ok := attrs.Value("request_id")
+	assert.True(t, ok)
+	assert.NotEmpty(t, requestID.AsString())
+	status, _ := attrs.Value("http.response.status_code")
+	assert.EqualValues(t, http.StatusOK, status.AsInt64())
+
+	assert.Equal(t, "GET /boot/assets/{arch}/{file}", spans[1].Name())
+	assert.Equal(t, codes.Unset, spans[1].Status().Code)
+}
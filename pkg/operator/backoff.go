@@ -0,0 +1,69 @@
+package operator
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// backoff tracks consecutive failures per object and hands out exponentially growing, jittered requeue delays.
+type backoff struct {
+	base   time.Duration
+	max    time.Duration
+	jitter float64
+
+	mu       sync.Mutex
+	failures map[types.NamespacedName]int
+}
+
+func newBackoff(base, max time.Duration, jitter float64) *backoff {
+	return &backoff{
+		base:     base,
+		max:      max,
+		jitter:   jitter,
+		failures: make(map[types.NamespacedName]int),
+	}
+}
+
+// Next records a failure for key and returns how long to wait before trying again.
+func (b *backoff) Next(key types.NamespacedName) time.Duration {
+	b.mu.Lock()
+	failures := b.failures[key]
+	b.failures[key] = failures + 1
+	b.mu.Unlock()
+
+	delay := b.base
+	for i := 0; i < failures && delay < b.max; i++ {
+		delay *= 2
+	}
+	delay = min(delay, b.max)
+
+	return jitter(delay, b.jitter)
+}
+
+// Failures returns the number of consecutive failures recorded for key.
+func (b *backoff) Failures(key types.NamespacedName) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.failures[key]
+}
+
+// Reset forgets the failures recorded for key.
+func (b *backoff) Reset(key types.NamespacedName) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.failures, key)
+}
+
+// jitter adds a random duration of up to factor*d to d. Unlike wait.Jitter a factor of zero disables the jitter.
+func jitter(d time.Duration, factor float64) time.Duration {
+	if factor <= 0 {
+		return d
+	}
+
+	return wait.Jitter(d, factor)
+}
@@ -0,0 +1,50 @@
+package operator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestBackoff(t *testing.T) {
+	key := types.NamespacedName{Namespace: "machines", Name: "m1"}
+	other := types.NamespacedName{Namespace: "machines", Name: "m2"}
+
+	t.Run("doubles up to the maximum", func(t *testing.T) {
+		b := newBackoff(time.Second, 10*time.Second, 0)
+
+		var delays []time.Duration
+		for range 6 {
+			delays = append(delays, b.Next(key))
+		}
+
+		assert.Equal(t, []time.Duration{
+			time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second,
+		}, delays)
+		assert.Equal(t, time.Second, b.Next(other))
+	})
+
+	t.Run("reset starts over", func(t *testing.T) {
+		b := newBackoff(time.Second, 10*time.Second, 0)
+		b.Next(key)
+		b.Next(key)
+
+		b.Reset(key)
+
+		assert.Equal(t, 0, b.Failures(key))
+		assert.Equal(t, time.Second, b.Next(key))
+	})
+
+	t.Run("jitter stays within bounds", func(t *testing.T) {
+		b := newBackoff(time.Second, 10*time.Second, 0.5)
+
+		for range 20 {
+			delay := b.Next(key)
+			b.Reset(key)
+			assert.GreaterOrEqual(t, delay, time.Second)
+			assert.LessOrEqual(t, delay, 1500*time.Millisecond)
+		}
+	})
+}
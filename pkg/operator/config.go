@@ -1,23 +1,129 @@
 package operator
 
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/lukaspj/talos-cluster-operator/pkg/api/v1alpha1"
+	"github.com/siderolabs/talos/pkg/machinery/gendata"
+
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+)
+
 type Config struct {
 	ProbeAddr            string
+	MetricsAddr          string
 	Namespace            string
 	EnableLeaderElection bool
 	ConfigSecretName     string
 	ConfigSecretKey      string
+	// WatchNamespaces restricts the operator to Machines, Clusters and Secrets in these namespaces. The operator's
+	// own namespace is always watched. Every namespace is watched when empty.
+	WatchNamespaces []string
+
+	// MachineBackoffBase is the requeue delay after the first failed health check of a Machine. It doubles on every
+	// consecutive failure up to MachineBackoffMax, and MachineBackoffJitter adds up to that fraction on top.
+	MachineBackoffBase   time.Duration
+	MachineBackoffMax    time.Duration
+	MachineBackoffJitter float64
+	// MachineResyncInterval is how often the health of a ready Machine is checked again.
+	MachineResyncInterval time.Duration
+	// EventInterval is the minimum time between two identical events on the same object.
+	EventInterval time.Duration
+	// TalosClientIdleTimeout is how long an unused Talos client is kept open.
+	TalosClientIdleTimeout time.Duration
+	// BMCRebootAfter is how long a claimed Machine with a BMC may be unreachable before it is power cycled.
+	BMCRebootAfter time.Duration
+	// RegistrationTimeout is how long a Machine registered by the config server may stay pending before it is
+	// deleted, releasing its name and address.
+	RegistrationTimeout time.Duration
+
+	// ImageFactoryURL is the Image Factory schematics of MachineSets are registered with, and ImageFactoryRegistry
+	// the registry serving its installer images.
+	ImageFactoryURL      string
+	ImageFactoryRegistry string
+	// TalosVersion is the installer image version of MachineSets which do not set one.
+	TalosVersion string
+	// RolloutInterval is how often a Cluster is requeued while its machines are upgraded one at a time.
+	RolloutInterval time.Duration
+
+	// ServerEnabled runs the machine config server inside the operator, on every replica. It is configured like the
+	// standalone server.
+	ServerEnabled bool
+
+	// OTLPEndpoint is the OTLP gRPC collector reconcile traces are exported to, e.g. otel-collector:4317. Tracing is
+	// disabled when empty.
+	OTLPEndpoint string `fang:"otlp_endpoint"`
+	// OTLPInsecure exports traces without TLS.
+	OTLPInsecure bool `fang:"otlp_insecure"`
 }
 
 func DefaultConfig() Config {
 	return Config{
-		ProbeAddr:            ":8081",
-		Namespace:            "talos-cluster-operator",
-		EnableLeaderElection: true,
-		ConfigSecretName:     "talos-config",
-		ConfigSecretKey:      "config",
+		ProbeAddr:             ":8081",
+		MetricsAddr:           ":8080",
+		Namespace:             "talos-cluster-operator",
+		EnableLeaderElection:  true,
+		ConfigSecretName:      "talos-config",
+		ConfigSecretKey:       "config",
+		MachineBackoffBase:    5 * time.Second,
+		MachineBackoffMax:     10 * time.Minute,
+		MachineBackoffJitter:  0.2,
+		MachineResyncInterval: 5 * time.Minute,
+		EventInterval:         15 * time.Minute,
+
+		TalosClientIdleTimeout: 10 * time.Minute,
+		BMCRebootAfter:         15 * time.Minute,
+		RegistrationTimeout:    30 * time.Minute,
+
+		ImageFactoryURL:      "https://factory.talos.dev",
+		ImageFactoryRegistry: "factory.talos.dev",
+		TalosVersion:         strings.TrimSpace(gendata.VersionTag),
+		RolloutInterval:      time.Minute,
 	}
 }
 
+// TalosConfigSecret returns the Secret holding the operator-wide talosconfig.
+func (c *Config) TalosConfigSecret() types.NamespacedName {
+	return types.NamespacedName{Namespace: c.Namespace, Name: c.ConfigSecretName}
+}
+
+// ClusterTalosConfigSecret returns the Secret and key holding the talosconfig used for the Cluster. Clusters
+// without a talosConfigRef use the operator-wide secret.
+func (c *Config) ClusterTalosConfigSecret(cluster *v1alpha1.Cluster) (types.NamespacedName, string) {
+	if ref := cluster.Spec.TalosConfigRef; ref != nil {
+		key := ref.Key
+		if key == "" {
+			key = c.ConfigSecretKey
+		}
+		return types.NamespacedName{Namespace: cluster.Namespace, Name: ref.Name}, key
+	}
+
+	return c.TalosConfigSecret(), c.ConfigSecretKey
+}
+
+// CacheNamespaces returns the namespaces the manager's cache is restricted to, or nil to watch every namespace.
+func (c *Config) CacheNamespaces() map[string]cache.Config {
+	if len(c.WatchNamespaces) == 0 {
+		return nil
+	}
+
+	namespaces := map[string]cache.Config{c.Namespace: {}}
+	for _, ns := range c.WatchNamespaces {
+		namespaces[ns] = cache.Config{}
+	}
+
+	return namespaces
+}
+
+// Watches reports whether the operator manages objects of the namespace. The manager's cache holds the Machines of
+// every namespace when the config server is embedded, as they share the machine CIDR.
+func (c *Config) Watches(namespace string) bool {
+	return len(c.WatchNamespaces) == 0 || namespace == c.Namespace || slices.Contains(c.WatchNamespaces, namespace)
+}
+
 func (c *Config) String() string {
 	return "Config{}"
 }
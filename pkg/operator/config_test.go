@@ -0,0 +1,17 @@
+package operator
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfig_Watches(t *testing.T) {
+	config := DefaultConfig()
+	assert.True(t, config.Watches("team-a"))
+
+	config.WatchNamespaces = []string{"machines"}
+	assert.True(t, config.Watches("machines"))
+	assert.True(t, config.Watches(config.Namespace))
+	assert.False(t, config.Watches("team-a"))
+}
@@ -0,0 +1,203 @@
+package operator
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/lukaspj/talos-cluster-operator/pkg/api/v1alpha1"
+	"github.com/lukaspj/talos-cluster-operator/pkg/conditions"
+	yaml "go.yaml.in/yaml/v4"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// maxDiffPaths is the number of differing fields listed in the ConfigInSync condition.
+const maxDiffPaths = 5
+
+// reconcileDrift compares the live machine config with the desired one and, when the MachineSet of the machine
+// selects an apply mode, re-applies the desired config. Machines without a desired config are left alone.
+func (t *TalosMachineReconciler) reconcileDrift(ctx context.Context, machine *v1alpha1.Machine) error {
+	secret := &corev1.Secret{}
+	name, referenced := t.desiredConfigSecret(machine)
+	err := t.Get(ctx, name, secret)
+	if !referenced && k8serrors.IsNotFound(err) {
+		return nil
+	}
+
+	inSync := t.configInSync(ctx, machine, secret.Data["config"], err)
+
+	return patchStatus(ctx, t.Client, MachineControllerName, machine, func(m *v1alpha1.Machine) {
+		conditions.Set(m, inSync)
+	})
+}
+
+// desiredConfigSecret returns the Secret holding the desired config of the machine, and whether the Machine
+// references it. Otherwise it is the config the config server rendered, which machines registered by hand lack.
+func (t *TalosMachineReconciler) desiredConfigSecret(machine *v1alpha1.Machine) (types.NamespacedName, bool) {
+	if ref := machine.Spec.ConfigSecretRef; ref != nil {
+		return types.NamespacedName{Namespace: machine.Namespace, Name: ref.Name}, true
+	}
+
+	return types.NamespacedName{Namespace: t.Config.Namespace, Name: machine.DesiredConfigSecretName()}, false
+}
+
+func (t *TalosMachineReconciler) configInSync(ctx context.Context, machine *v1alpha1.Machine, desired []byte, desiredErr error) metav1.Condition {
+	condition := metav1.Condition{
+		Type:    v1alpha1.MachineConfigInSyncCondition,
+		Status:  metav1.ConditionTrue,
+		Reason:  "InSync",
+		Message: "Live machine config matches the desired config",
+	}
+
+	if desiredErr != nil {
+		condition.Status = metav1.ConditionUnknown
+		condition.Reason = "DesiredConfigUnavailable"
+		condition.Message = desiredErr.Error()
+		return condition
+	}
+
+	live, err := t.Talos.MachineConfig(ctx, machine)
+	if err != nil {
+		condition.Status = metav1.ConditionUnknown
+		condition.Reason = "LiveConfigUnavailable"
+		condition.Message = err.Error()
+		return condition
+	}
+
+	paths, err := configDiff(desired, live)
+	if err != nil {
+		condition.Status = metav1.ConditionUnknown
+		condition.Reason = "InvalidConfig"
+		condition.Message = err.Error()
+		return condition
+	}
+	if len(paths) == 0 {
+		return condition
+	}
+
+	summary := diffSummary(paths)
+	condition.Status = metav1.ConditionFalse
+	condition.Reason = "Drifted"
+	condition.Message = summary
+
+	mode, err := t.configApplyMode(ctx, machine)
+	if err != nil || mode == "" {
+		t.Recorder.Eventf(machine, "Warning", "ConfigDrifted", "Live machine config drifted: %s", summary)
+		return condition
+	}
+
+	if err := t.Talos.ApplyConfiguration(ctx, machine, desired, mode); err != nil {
+		t.Recorder.Eventf(machine, "Warning", "ConfigReapplyFailed", "Unable to re-apply machine config: %s", err)
+		condition.Reason = "ReapplyFailed"
+		condition.Message = fmt.Sprintf("%s; re-apply failed: %s", summary, err)
+		return condition
+	}
+
+	t.Recorder.Eventf(machine, "Normal", "ConfigReapplied", "Re-applied machine config in %s mode: %s", mode, summary)
+	condition.Reason = "Reapplied"
+	condition.Message = fmt.Sprintf("Re-applied desired config in %s mode: %s", mode, summary)
+
+	return condition
+}
+
+// configApplyMode returns the apply mode of the MachineSet selecting the machine in the Cluster claiming it.
+func (t *TalosMachineReconciler) configApplyMode(ctx context.Context, machine *v1alpha1.Machine) (v1alpha1.ConfigApplyMode, error) {
+	if machine.Status.Cluster == "" {
+		return "", nil
+	}
+
+	namespace, name, _ := strings.Cut(machine.Status.Cluster, "/")
+	cluster := &v1alpha1.Cluster{}
+	if err := t.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, cluster); err != nil {
+		return "", err
+	}
+
+	if set := machineSetFor(cluster, machine); set != nil {
+		return set.ConfigApplyMode, nil
+	}
+
+	return "", nil
+}
+
+// configDiff returns the dotted paths of the fields which differ between the first documents of two machine configs.
+// Missing and empty fields are considered equal, as Talos omits empty fields when it stores a config.
+func configDiff(desired, live []byte) ([]string, error) {
+	var d, l any
+	if err := yaml.NewDecoder(bytes.NewReader(desired)).Decode(&d); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("unable to decode desired config: %w", err)
+	}
+	if err := yaml.NewDecoder(bytes.NewReader(live)).Decode(&l); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("unable to decode live config: %w", err)
+	}
+
+	return diffPaths("", d, l), nil
+}
+
+func diffPaths(path string, a, b any) []string {
+	if isEmpty(a) && isEmpty(b) {
+		return nil
+	}
+
+	am, aok := a.(map[string]any)
+	bm, bok := b.(map[string]any)
+	if !aok || !bok {
+		if reflect.DeepEqual(a, b) {
+			return nil
+		}
+		return []string{path}
+	}
+
+	keys := slices.Sorted(maps.Keys(am))
+	for k := range bm {
+		if _, ok := am[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	slices.Sort(keys)
+
+	var paths []string
+	for _, k := range keys {
+		child := k
+		if path != "" {
+			child = path + "." + k
+		}
+		paths = append(paths, diffPaths(child, am[k], bm[k])...)
+	}
+
+	return paths
+}
+
+func isEmpty(v any) bool {
+	switch v := v.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case map[string]any:
+		return len(v) == 0
+	case []any:
+		return len(v) == 0
+	}
+
+	return false
+}
+
+// diffSummary lists the first differing fields. Values are left out as machine configs hold secrets.
+func diffSummary(paths []string) string {
+	listed := paths[:min(len(paths), maxDiffPaths)]
+	summary := fmt.Sprintf("%d field(s) differ: %s", len(paths), strings.Join(listed, ", "))
+	if len(paths) > maxDiffPaths {
+		summary += ", ..."
+	}
+
+	return summary
+}
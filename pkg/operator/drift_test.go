@@ -0,0 +1,147 @@
+package operator
+
+import (
+	"context"
+	"testing"
+
+	"github.com/lukaspj/talos-cluster-operator/pkg/api/v1alpha1"
+	"github.com/lukaspj/talos-cluster-operator/pkg/conditions"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+const desiredConfig = `version: v1alpha1
+machine:
+  type: worker
+  token: secret-token
+  network:
+    hostname: node-1
+  kubelet: {}
+cluster:
+  clusterName: prod
+`
+
+func TestConfigDiff(t *testing.T) {
+	paths, err := configDiff([]byte(desiredConfig), []byte(desiredConfig+"---\nkind: HostnameConfig\n"))
+	require.NoError(t, err)
+	assert.Empty(t, paths)
+
+	live := `version: v1alpha1
+machine:
+  type: worker
+  token: secret-token
+  network:
+    hostname: edited
+  install:
+    disk: /dev/sda
+cluster:
+  clusterName: prod
+`
+	paths, err = configDiff([]byte(desiredConfig), []byte(live))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"machine.install", "machine.network.hostname"}, paths)
+
+	assert.Equal(t, "2 field(s) differ: machine.install, machine.network.hostname", diffSummary(paths))
+	assert.Equal(t, "6 field(s) differ: a, b, c, d, e, ...", diffSummary([]string{"a", "b", "c", "d", "e", "f"}))
+}
+
+func TestTalosMachineReconciler_reconcileDrift(t *testing.T) {
+	ctx := context.Background()
+
+	newReconciler := func(t *testing.T, mode v1alpha1.ConfigApplyMode) (*TalosMachineReconciler, *fakeMachineAPI, *v1alpha1.Machine) {
+		scheme := runtime.NewScheme()
+		require.NoError(t, corev1.AddToScheme(scheme))
+		require.NoError(t, v1alpha1.AddToScheme(scheme))
+
+		machine := &v1alpha1.Machine{
+			ObjectMeta: metav1.ObjectMeta{Name: "m1", Namespace: "machines", Labels: map[string]string{"role": "worker"}},
+			Spec: v1alpha1.MachineSpec{
+				IP:              "10.0.0.1",
+				ConfigSecretRef: &corev1.LocalObjectReference{Name: "m1-config"},
+			},
+			Status: v1alpha1.MachineStatus{Cluster: "default/c1"},
+		}
+		cluster := workerCluster()
+		cluster.Spec.WorkerSets[0].ConfigApplyMode = mode
+
+		c := fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithStatusSubresource(&v1alpha1.Machine{}).
+			WithObjects(machine, cluster, &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "m1-config", Namespace: "machines"},
+				Data:       map[string][]byte{"config": []byte(desiredConfig)},
+			}).
+			Build()
+		require.NoError(t, c.Status().Update(ctx, machine))
+
+		talos := &fakeMachineAPI{liveConfig: []byte(desiredConfig)}
+		return &TalosMachineReconciler{
+			Client:   c,
+			Scheme:   scheme,
+			Recorder: record.NewFakeRecorder(10),
+			Config:   DefaultConfig(),
+			Talos:    talos,
+		}, talos, machine
+	}
+
+	inSync := func(t *testing.T, reconciler *TalosMachineReconciler, machine *v1alpha1.Machine) *metav1.Condition {
+		got := &v1alpha1.Machine{}
+		require.NoError(t, reconciler.Get(ctx, client.ObjectKeyFromObject(machine), got))
+		condition := conditions.Get(got, v1alpha1.MachineConfigInSyncCondition)
+		require.NotNil(t, condition)
+		return condition
+	}
+
+	t.Run("in sync", func(t *testing.T) {
+		reconciler, _, machine := newReconciler(t, "")
+		require.NoError(t, reconciler.reconcileDrift(ctx, machine))
+		assert.Equal(t, metav1.ConditionTrue, inSync(t, reconciler, machine).Status)
+	})
+
+	t.Run("drift is reported", func(t *testing.T) {
+		reconciler, talos, machine := newReconciler(t, "")
+		talos.liveConfig = []byte("version: v1alpha1\nmachine:\n  type: controlplane\n")
+
+		require.NoError(t, reconciler.reconcileDrift(ctx, machine))
+		condition := inSync(t, reconciler, machine)
+		assert.Equal(t, metav1.ConditionFalse, condition.Status)
+		assert.Equal(t, "Drifted", condition.Reason)
+		assert.Contains(t, condition.Message, "machine.type")
+		assert.NotContains(t, condition.Message, "secret-token")
+		assert.Empty(t, talos.applied)
+	})
+
+	t.Run("rendered config in the operator namespace", func(t *testing.T) {
+		reconciler, _, machine := newReconciler(t, "")
+		machine.Spec.ConfigSecretRef = nil
+		require.NoError(t, reconciler.reconcileDrift(ctx, machine))
+		got := &v1alpha1.Machine{}
+		require.NoError(t, reconciler.Get(ctx, client.ObjectKeyFromObject(machine), got))
+		assert.Nil(t, conditions.Get(got, v1alpha1.MachineConfigInSyncCondition), "machines without a desired config are not checked")
+
+		require.NoError(t, reconciler.Create(ctx, &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "machines.m1-config", Namespace: reconciler.Config.Namespace},
+			Data:       map[string][]byte{"config": []byte(desiredConfig)},
+		}))
+		require.NoError(t, reconciler.reconcileDrift(ctx, machine))
+		assert.Equal(t, metav1.ConditionTrue, inSync(t, reconciler, machine).Status)
+	})
+
+	t.Run("drift is re-applied in the mode of the machine set", func(t *testing.T) {
+		reconciler, talos, machine := newReconciler(t, v1alpha1.ConfigApplyModeNoReboot)
+		talos.liveConfig = []byte("version: v1alpha1\n")
+
+		require.NoError(t, reconciler.reconcileDrift(ctx, machine))
+		assert.Equal(t, []v1alpha1.ConfigApplyMode{v1alpha1.ConfigApplyModeNoReboot}, talos.applied)
+		assert.Equal(t, "Reapplied", inSync(t, reconciler, machine).Reason)
+
+		require.NoError(t, reconciler.reconcileDrift(ctx, machine))
+		assert.Equal(t, metav1.ConditionTrue, inSync(t, reconciler, machine).Status)
+	})
+}
@@ -0,0 +1,74 @@
+package operator
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+)
+
+// dedupRecorder drops events identical to one recorded for the same object within the configured interval, so a
+// machine failing the same check on every retry does not flood the event log.
+type dedupRecorder struct {
+	record.EventRecorder
+	interval time.Duration
+
+	mu   sync.Mutex
+	seen map[eventKey]time.Time
+}
+
+type eventKey struct {
+	uid       types.UID
+	eventType string
+	reason    string
+	message   string
+}
+
+func newDedupRecorder(recorder record.EventRecorder, interval time.Duration) *dedupRecorder {
+	return &dedupRecorder{
+		EventRecorder: recorder,
+		interval:      interval,
+		seen:          make(map[eventKey]time.Time),
+	}
+}
+
+func (d *dedupRecorder) Event(object runtime.Object, eventtype, reason, message string) {
+	if d.suppress(object, eventtype, reason, message) {
+		return
+	}
+	d.EventRecorder.Event(object, eventtype, reason, message)
+}
+
+func (d *dedupRecorder) Eventf(object runtime.Object, eventtype, reason, messageFmt string, args ...interface{}) {
+	d.Event(object, eventtype, reason, fmt.Sprintf(messageFmt, args...))
+}
+
+func (d *dedupRecorder) suppress(object runtime.Object, eventtype, reason, message string) bool {
+	accessor, err := meta.Accessor(object)
+	if err != nil {
+		return false
+	}
+
+	key := eventKey{uid: accessor.GetUID(), eventType: eventtype, reason: reason, message: message}
+	now := time.Now()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for k, at := range d.seen {
+		if now.Sub(at) >= d.interval {
+			delete(d.seen, k)
+		}
+	}
+
+	if _, ok := d.seen[key]; ok {
+		return true
+	}
+	d.seen[key] = now
+
+	return false
+}
@@ -0,0 +1,60 @@
+package operator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/lukaspj/talos-cluster-operator/pkg/api/v1alpha1"
+	"github.com/lukaspj/talos-cluster-operator/pkg/readyz"
+	"github.com/lukaspj/talos-cluster-operator/pkg/talosclient"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ReadyzChecks returns the readiness checks of the operator by name. The manager serves the detail of every check
+// on /readyz?verbose.
+func ReadyzChecks(apiReader client.Reader, informers cache.Cache, talos *talosclient.Pool, cfg Config) map[string]readyz.Check {
+	return map[string]readyz.Check{
+		"kubernetes-api": KubernetesAPICheck(apiReader, cfg.Namespace),
+		"informer-sync":  InformerSyncCheck(informers),
+		"talos":          TalosCheck(apiReader, talos, cfg),
+	}
+}
+
+// KubernetesAPICheck lists Clusters in the namespace, bypassing the informer cache.
+func KubernetesAPICheck(c client.Reader, namespace string) readyz.Check {
+	return func(ctx context.Context) error {
+		return c.List(ctx, &v1alpha1.ClusterList{}, client.InNamespace(namespace), client.Limit(1))
+	}
+}
+
+// InformerSyncCheck fails until the informers of every watched kind have synced.
+func InformerSyncCheck(informers cache.Cache) readyz.Check {
+	return func(ctx context.Context) error {
+		if !informers.WaitForCacheSync(ctx) {
+			return errors.New("informer caches are not synced")
+		}
+
+		return nil
+	}
+}
+
+// TalosCheck reaches the Talos API on the endpoints of the operator-wide talosconfig.
+func TalosCheck(c client.Reader, talos *talosclient.Pool, cfg Config) readyz.Check {
+	return func(ctx context.Context) error {
+		credentials, err := talosclient.LoadSecretCredentials(ctx, c, cfg.TalosConfigSecret(), cfg.ConfigSecretKey)
+		if err != nil {
+			return fmt.Errorf("load talosconfig: %w", err)
+		}
+		ctl, err := talos.Client(ctx, credentials)
+		if err != nil {
+			return err
+		}
+
+		return observeTalosCall("version", func() error {
+			_, err := ctl.Version(ctx)
+			return err
+		})
+	}
+}
@@ -0,0 +1,26 @@
+package operator
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lukaspj/talos-cluster-operator/pkg/api/v1alpha1"
+	"github.com/lukaspj/talos-cluster-operator/pkg/talosclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestReadyzChecks(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, v1alpha1.AddToScheme(scheme))
+	c := fake.NewClientBuilder().WithScheme(scheme).Build()
+	ctx := context.Background()
+
+	assert.NoError(t, KubernetesAPICheck(c, "talos-cluster-operator")(ctx))
+
+	err := TalosCheck(c, talosclient.NewPool(time.Minute), DefaultConfig())(ctx)
+	assert.ErrorContains(t, err, "load talosconfig")
+}
@@ -0,0 +1,106 @@
+package operator
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/lukaspj/talos-cluster-operator/pkg/api/v1alpha1"
+	"github.com/lukaspj/talos-cluster-operator/pkg/conditions"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	reasonResetIssued = "ResetIssued"
+	reasonResetFailed = "ResetFailed"
+)
+
+// reconcileDelete carries out the deletion policy of a deleted Machine. The finalizer, and with it the Machine's
+// claim on its IP, is only released once the physical machine no longer uses the IP.
+func (t *TalosMachineReconciler) reconcileDelete(ctx context.Context, machine *v1alpha1.Machine) (ctrl.Result, error) {
+	if !controllerutil.ContainsFinalizer(machine, v1alpha1.MachineFinalizer) {
+		return ctrl.Result{}, nil
+	}
+
+	key := client.ObjectKeyFromObject(machine)
+	// A pending registration never came up with its config, so there is nothing of ours to wipe.
+	if machine.Spec.DeletionPolicy == v1alpha1.MachineDeletionPolicyReset && !machine.RegistrationPending() {
+		done, err := t.reset(ctx, machine)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if !done {
+			return ctrl.Result{RequeueAfter: t.backoff.Next(key)}, nil
+		}
+	}
+
+	t.backoff.Reset(key)
+
+	// The config and address claim of the config server live in our namespace, out of reach of garbage collection.
+	configSecret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: t.Config.Namespace, Name: machine.DesiredConfigSecretName()}}
+	if err := t.Delete(ctx, configSecret); client.IgnoreNotFound(err) != nil {
+		return ctrl.Result{}, err
+	}
+	if err := t.releaseIPClaim(ctx, machine); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	base := machine.DeepCopy()
+	controllerutil.RemoveFinalizer(machine, v1alpha1.MachineFinalizer)
+	if err := t.Patch(ctx, machine, client.MergeFromWithOptions(base, client.MergeFromWithOptimisticLock{}), client.FieldOwner(MachineControllerName)); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	slog.Info("released machine", "machine", key, "deletionPolicy", machine.Spec.DeletionPolicy)
+	return ctrl.Result{}, nil
+}
+
+// releaseIPClaim deletes the claim the config server took on the address of the machine, unless another Machine
+// holds it.
+func (t *TalosMachineReconciler) releaseIPClaim(ctx context.Context, machine *v1alpha1.Machine) error {
+	claim := &coordinationv1.Lease{}
+	err := t.Get(ctx, types.NamespacedName{Namespace: t.Config.Namespace, Name: v1alpha1.IPClaimName(machine.Spec.IP)}, claim)
+	if err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if ptr.Deref(claim.Spec.HolderIdentity, "") != client.ObjectKeyFromObject(machine).String() {
+		return nil
+	}
+
+	return client.IgnoreNotFound(t.Delete(ctx, claim, client.Preconditions{UID: &claim.UID}))
+}
+
+// reset issues a Talos reset to the machine once and reports whether it has since come up in maintenance mode.
+func (t *TalosMachineReconciler) reset(ctx context.Context, machine *v1alpha1.Machine) (bool, error) {
+	inMaintenance, err := t.Talos.InMaintenance(ctx, machine)
+	if err != nil {
+		return false, err
+	}
+	if inMaintenance {
+		t.Recorder.Event(machine, "Normal", "ResetCompleted", "Machine is in maintenance mode")
+		return true, nil
+	}
+
+	if c := conditions.Get(machine, v1alpha1.MachineResetCondition); c != nil && c.Reason == reasonResetIssued {
+		return false, nil
+	}
+
+	reason, message := reasonResetIssued, "Waiting for the machine to enter maintenance mode"
+	if err := t.Talos.Reset(ctx, machine); err != nil {
+		reason, message = reasonResetFailed, err.Error()
+		t.Recorder.Event(machine, "Warning", reasonResetFailed,
+			"Unable to reset machine, set the deletion policy to Retain to delete it anyway: "+err.Error())
+	} else {
+		t.Recorder.Event(machine, "Normal", reasonResetIssued, message)
+	}
+
+	return false, patchStatus(ctx, t.Client, MachineControllerName, machine, func(m *v1alpha1.Machine) {
+		conditions.MarkFalse(m, v1alpha1.MachineResetCondition, reason, message)
+	})
+}
@@ -0,0 +1,161 @@
+package operator
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lukaspj/talos-cluster-operator/pkg/api/v1alpha1"
+	"github.com/lukaspj/talos-cluster-operator/pkg/conditions"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+type fakeMachineAPI struct {
+	resets        int
+	resetErr      error
+	inMaintenance bool
+	liveConfig    []byte
+	applied       []v1alpha1.ConfigApplyMode
+	shutdowns     int
+}
+
+func (f *fakeMachineAPI) Reset(context.Context, *v1alpha1.Machine) error {
+	f.resets++
+	return f.resetErr
+}
+
+func (f *fakeMachineAPI) InMaintenance(context.Context, *v1alpha1.Machine) (bool, error) {
+	return f.inMaintenance, nil
+}
+
+func (f *fakeMachineAPI) MachineConfig(context.Context, *v1alpha1.Machine) ([]byte, error) {
+	return f.liveConfig, nil
+}
+
+func (f *fakeMachineAPI) ApplyConfiguration(_ context.Context, _ *v1alpha1.Machine, config []byte, mode v1alpha1.ConfigApplyMode) error {
+	f.applied = append(f.applied, mode)
+	f.liveConfig = config
+	return nil
+}
+
+func (f *fakeMachineAPI) Shutdown(context.Context, *v1alpha1.Machine) error {
+	f.shutdowns++
+	return nil
+}
+
+func newDeletedMachine(t *testing.T, policy v1alpha1.MachineDeletionPolicy) (*TalosMachineReconciler, *fakeMachineAPI, ctrl.Request) {
+	ctx := context.Background()
+
+	scheme := runtime.NewScheme()
+	require.NoError(t, corev1.AddToScheme(scheme))
+	require.NoError(t, coordinationv1.AddToScheme(scheme))
+	require.NoError(t, v1alpha1.AddToScheme(scheme))
+
+	machine := &v1alpha1.Machine{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "m1",
+			Namespace:  "machines",
+			Finalizers: []string{v1alpha1.MachineFinalizer},
+		},
+		Spec: v1alpha1.MachineSpec{IP: "10.0.0.1", DeletionPolicy: policy},
+	}
+
+	c := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithStatusSubresource(&v1alpha1.Machine{}).
+		WithObjects(machine,
+			&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: machine.DesiredConfigSecretName(), Namespace: DefaultConfig().Namespace},
+			},
+			&coordinationv1.Lease{
+				ObjectMeta: metav1.ObjectMeta{Name: v1alpha1.IPClaimName("10.0.0.1"), Namespace: DefaultConfig().Namespace},
+				Spec:       coordinationv1.LeaseSpec{HolderIdentity: ptr.To("machines/m1")},
+			},
+		).
+		Build()
+	require.NoError(t, c.Delete(ctx, machine))
+
+	talos := &fakeMachineAPI{}
+	reconciler := &TalosMachineReconciler{
+		Client:   c,
+		Scheme:   scheme,
+		Recorder: record.NewFakeRecorder(10),
+		Config:   DefaultConfig(),
+		Talos:    talos,
+		backoff:  newBackoff(time.Second, time.Minute, 0),
+	}
+
+	return reconciler, talos, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(machine)}
+}
+
+func TestTalosMachineReconciler_ReconcileDelete(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("retain releases the machine immediately", func(t *testing.T) {
+		reconciler, talos, req := newDeletedMachine(t, v1alpha1.MachineDeletionPolicyRetain)
+
+		_, err := reconciler.Reconcile(ctx, req)
+		require.NoError(t, err)
+
+		assert.Equal(t, 0, talos.resets)
+		err = reconciler.Get(ctx, req.NamespacedName, &v1alpha1.Machine{})
+		assert.True(t, k8serrors.IsNotFound(err))
+
+		err = reconciler.Get(ctx, client.ObjectKey{Namespace: reconciler.Config.Namespace, Name: "machines.m1-config"}, &corev1.Secret{})
+		assert.True(t, k8serrors.IsNotFound(err), "the rendered config is deleted with the machine")
+		err = reconciler.Get(ctx, client.ObjectKey{Namespace: reconciler.Config.Namespace, Name: "machine-ip-10-0-0-1"}, &coordinationv1.Lease{})
+		assert.True(t, k8serrors.IsNotFound(err), "the address claim is released with the machine")
+	})
+
+	t.Run("reset waits for maintenance mode", func(t *testing.T) {
+		reconciler, talos, req := newDeletedMachine(t, v1alpha1.MachineDeletionPolicyReset)
+
+		result, err := reconciler.Reconcile(ctx, req)
+		require.NoError(t, err)
+		assert.Positive(t, result.RequeueAfter)
+		assert.Equal(t, 1, talos.resets)
+
+		machine := &v1alpha1.Machine{}
+		require.NoError(t, reconciler.Get(ctx, req.NamespacedName, machine))
+		assert.Equal(t, reasonResetIssued, conditions.Get(machine, v1alpha1.MachineResetCondition).Reason)
+
+		// The reset is only issued once while the machine reboots.
+		_, err = reconciler.Reconcile(ctx, req)
+		require.NoError(t, err)
+		assert.Equal(t, 1, talos.resets)
+
+		talos.inMaintenance = true
+		_, err = reconciler.Reconcile(ctx, req)
+		require.NoError(t, err)
+
+		err = reconciler.Get(ctx, req.NamespacedName, &v1alpha1.Machine{})
+		assert.True(t, k8serrors.IsNotFound(err))
+	})
+
+	t.Run("failed reset is retried", func(t *testing.T) {
+		reconciler, talos, req := newDeletedMachine(t, v1alpha1.MachineDeletionPolicyReset)
+		talos.resetErr = errors.New("connection refused")
+
+		_, err := reconciler.Reconcile(ctx, req)
+		require.NoError(t, err)
+		_, err = reconciler.Reconcile(ctx, req)
+		require.NoError(t, err)
+
+		assert.Equal(t, 2, talos.resets)
+		machine := &v1alpha1.Machine{}
+		require.NoError(t, reconciler.Get(ctx, req.NamespacedName, machine))
+		assert.Equal(t, reasonResetFailed, conditions.Get(machine, v1alpha1.MachineResetCondition).Reason)
+	})
+}
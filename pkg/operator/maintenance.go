@@ -0,0 +1,101 @@
+package operator
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/lukaspj/talos-cluster-operator/pkg/api/v1alpha1"
+	"github.com/lukaspj/talos-cluster-operator/pkg/conditions"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// reconcileMaintenance cordons and drains the Kubernetes node of a machine in maintenance and then shuts it down if
+// requested. It reports whether a step is still in progress.
+func (t *TalosMachineReconciler) reconcileMaintenance(ctx context.Context, machine *v1alpha1.Machine) (bool, error) {
+	if !machine.InMaintenance() {
+		return false, t.restoreFromMaintenance(ctx, machine)
+	}
+
+	cordoned := metav1.Condition{
+		Type:    v1alpha1.MachineCordonedCondition,
+		Status:  metav1.ConditionTrue,
+		Reason:  "Cordoned",
+		Message: "Kubernetes node is cordoned",
+	}
+	drained := metav1.Condition{
+		Type:    v1alpha1.MachineDrainedCondition,
+		Status:  metav1.ConditionTrue,
+		Reason:  "Drained",
+		Message: "Kubernetes node is drained",
+	}
+
+	var pending bool
+	if machine.Status.Cluster == "" {
+		cordoned.Reason, cordoned.Message = "NotClaimed", "Machine is not part of a cluster"
+		drained.Reason, drained.Message = "NotClaimed", "Machine is not part of a cluster"
+	} else if err := t.Workload.Cordon(ctx, machine, true); err != nil {
+		t.Recorder.Eventf(machine, "Warning", "CordonFailed", "Unable to cordon node: %s", err)
+		cordoned.Status, cordoned.Reason, cordoned.Message = metav1.ConditionFalse, "CordonFailed", err.Error()
+		drained.Status, drained.Reason, drained.Message = metav1.ConditionUnknown, "WaitingForCordon", "Waiting for the node to be cordoned"
+		pending = true
+	} else if remaining, err := t.Workload.Drain(ctx, machine); err != nil {
+		t.Recorder.Eventf(machine, "Warning", "DrainFailed", "Unable to drain node: %s", err)
+		drained.Status, drained.Reason, drained.Message = metav1.ConditionFalse, "DrainFailed", err.Error()
+		pending = true
+	} else if remaining > 0 {
+		drained.Status, drained.Reason = metav1.ConditionFalse, "Draining"
+		drained.Message = fmt.Sprintf("Waiting for %d pod(s) to be evicted", remaining)
+		pending = true
+	}
+
+	var shutdown *metav1.Condition
+	if machine.Spec.Maintenance != nil && machine.Spec.Maintenance.Shutdown {
+		shutdown = conditions.Get(machine, v1alpha1.MachineShutdownCondition)
+		switch {
+		case shutdown != nil && shutdown.Status == metav1.ConditionTrue:
+		case drained.Status != metav1.ConditionTrue:
+			shutdown = &metav1.Condition{Type: v1alpha1.MachineShutdownCondition, Status: metav1.ConditionUnknown, Reason: "WaitingForDrain", Message: "Waiting for the node to be drained"}
+		default:
+			shutdown = &metav1.Condition{Type: v1alpha1.MachineShutdownCondition, Status: metav1.ConditionTrue, Reason: "ShutdownIssued", Message: "Machine was shut down for maintenance"}
+			if err := t.Talos.Shutdown(ctx, machine); err != nil {
+				t.Recorder.Eventf(machine, "Warning", "ShutdownFailed", "Unable to shut down machine: %s", err)
+				shutdown.Status, shutdown.Reason, shutdown.Message = metav1.ConditionFalse, "ShutdownFailed", err.Error()
+				pending = true
+			} else {
+				t.Recorder.Event(machine, "Normal", "ShutdownIssued", "Machine was shut down for maintenance")
+			}
+		}
+	}
+
+	return pending, patchStatus(ctx, t.Client, MachineControllerName, machine, func(m *v1alpha1.Machine) {
+		conditions.Set(m, cordoned)
+		conditions.Set(m, drained)
+		if shutdown != nil {
+			conditions.Set(m, *shutdown)
+		} else {
+			conditions.Delete(m, v1alpha1.MachineShutdownCondition)
+		}
+	})
+}
+
+// restoreFromMaintenance uncordons the node of a machine whose maintenance was cleared. A machine which was shut
+// down is powered on again through its BMC, if it has one, as it is claimed while powered off.
+func (t *TalosMachineReconciler) restoreFromMaintenance(ctx context.Context, machine *v1alpha1.Machine) error {
+	if conditions.Get(machine, v1alpha1.MachineCordonedCondition) == nil {
+		return nil
+	}
+
+	if machine.Status.Cluster != "" {
+		if err := t.Workload.Cordon(ctx, machine, false); err != nil {
+			t.Recorder.Eventf(machine, "Warning", "UncordonFailed", "Unable to uncordon node: %s", err)
+			return err
+		}
+	}
+	t.Recorder.Event(machine, "Normal", "MaintenanceCleared", "Machine is back in service")
+
+	return patchStatus(ctx, t.Client, MachineControllerName, machine, func(m *v1alpha1.Machine) {
+		conditions.Delete(m, v1alpha1.MachineCordonedCondition)
+		conditions.Delete(m, v1alpha1.MachineDrainedCondition)
+		conditions.Delete(m, v1alpha1.MachineShutdownCondition)
+	})
+}
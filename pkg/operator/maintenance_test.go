@@ -0,0 +1,186 @@
+package operator
+
+import (
+	"context"
+	"testing"
+
+	"github.com/lukaspj/talos-cluster-operator/pkg/api/v1alpha1"
+	"github.com/lukaspj/talos-cluster-operator/pkg/conditions"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+type fakeWorkloadNodes struct {
+	unschedulable bool
+	pods          int
+}
+
+func (f *fakeWorkloadNodes) Cordon(_ context.Context, _ *v1alpha1.Machine, unschedulable bool) error {
+	f.unschedulable = unschedulable
+	return nil
+}
+
+// Drain evicts one pod per call.
+func (f *fakeWorkloadNodes) Drain(context.Context, *v1alpha1.Machine) (int, error) {
+	f.pods = max(f.pods-1, 0)
+	return f.pods, nil
+}
+
+func TestTalosMachineReconciler_reconcileMaintenance(t *testing.T) {
+	ctx := context.Background()
+
+	scheme := runtime.NewScheme()
+	require.NoError(t, v1alpha1.AddToScheme(scheme))
+
+	machine := &v1alpha1.Machine{
+		ObjectMeta: metav1.ObjectMeta{Name: "m1", Namespace: "machines"},
+		Spec: v1alpha1.MachineSpec{
+			IP:          "10.0.0.1",
+			Maintenance: &v1alpha1.MachineMaintenance{Reason: "replace disk", Shutdown: true},
+		},
+	}
+	c := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithStatusSubresource(&v1alpha1.Machine{}).
+		WithObjects(machine).
+		Build()
+	machine.Status.Cluster = "default/c1"
+	require.NoError(t, c.Status().Update(ctx, machine))
+
+	talos := &fakeMachineAPI{}
+	workload := &fakeWorkloadNodes{pods: 2}
+	reconciler := &TalosMachineReconciler{
+		Client:   c,
+		Scheme:   scheme,
+		Recorder: record.NewFakeRecorder(10),
+		Config:   DefaultConfig(),
+		Talos:    talos,
+		Workload: workload,
+	}
+
+	get := func() *v1alpha1.Machine {
+		got := &v1alpha1.Machine{}
+		require.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(machine), got))
+		return got
+	}
+
+	pending, err := reconciler.reconcileMaintenance(ctx, get())
+	require.NoError(t, err)
+	assert.True(t, pending)
+	assert.True(t, workload.unschedulable)
+	assert.True(t, conditions.IsTrue(get(), v1alpha1.MachineCordonedCondition))
+	assert.Equal(t, "Draining", conditions.Get(get(), v1alpha1.MachineDrainedCondition).Reason)
+	assert.Equal(t, "WaitingForDrain", conditions.Get(get(), v1alpha1.MachineShutdownCondition).Reason)
+	assert.Zero(t, talos.shutdowns)
+
+	pending, err = reconciler.reconcileMaintenance(ctx, get())
+	require.NoError(t, err)
+	assert.False(t, pending)
+	assert.True(t, conditions.IsTrue(get(), v1alpha1.MachineDrainedCondition))
+	assert.True(t, conditions.IsTrue(get(), v1alpha1.MachineShutdownCondition))
+	assert.Equal(t, 1, talos.shutdowns)
+
+	// The machine is only shut down once.
+	_, err = reconciler.reconcileMaintenance(ctx, get())
+	require.NoError(t, err)
+	assert.Equal(t, 1, talos.shutdowns)
+
+	cleared := get()
+	cleared.Spec.Maintenance = nil
+	require.NoError(t, c.Update(ctx, cleared))
+
+	pending, err = reconciler.reconcileMaintenance(ctx, get())
+	require.NoError(t, err)
+	assert.False(t, pending)
+	assert.False(t, workload.unschedulable)
+	assert.Nil(t, conditions.Get(get(), v1alpha1.MachineCordonedCondition))
+	assert.Nil(t, conditions.Get(get(), v1alpha1.MachineShutdownCondition))
+}
+
+func TestTalosMachineReconciler_reconcileMaintenanceAnnotation(t *testing.T) {
+	ctx := context.Background()
+
+	scheme := runtime.NewScheme()
+	require.NoError(t, v1alpha1.AddToScheme(scheme))
+
+	machine := &v1alpha1.Machine{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "m1",
+			Namespace:   "machines",
+			Annotations: map[string]string{v1alpha1.MachineMaintenanceAnnotation: "replace disk"},
+		},
+		Spec: v1alpha1.MachineSpec{IP: "10.0.0.1"},
+	}
+	c := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithStatusSubresource(&v1alpha1.Machine{}).
+		WithObjects(machine).
+		Build()
+	machine.Status.Cluster = "default/c1"
+	require.NoError(t, c.Status().Update(ctx, machine))
+
+	talos := &fakeMachineAPI{}
+	workload := &fakeWorkloadNodes{}
+	reconciler := &TalosMachineReconciler{
+		Client:   c,
+		Scheme:   scheme,
+		Recorder: record.NewFakeRecorder(10),
+		Config:   DefaultConfig(),
+		Talos:    talos,
+		Workload: workload,
+	}
+
+	pending, err := reconciler.reconcileMaintenance(ctx, machine)
+	require.NoError(t, err)
+	assert.False(t, pending)
+	assert.True(t, workload.unschedulable)
+	assert.True(t, conditions.IsTrue(machine, v1alpha1.MachineDrainedCondition))
+	assert.Nil(t, conditions.Get(machine, v1alpha1.MachineShutdownCondition), "the annotation does not shut machines down")
+	assert.Zero(t, talos.shutdowns)
+
+	delete(machine.Annotations, v1alpha1.MachineMaintenanceAnnotation)
+	require.NoError(t, c.Update(ctx, machine))
+	_, err = reconciler.reconcileMaintenance(ctx, machine)
+	require.NoError(t, err)
+	assert.False(t, workload.unschedulable)
+}
+
+func TestTalosMachineReconciler_claimingClusterInMaintenance(t *testing.T) {
+	ctx := context.Background()
+
+	scheme := runtime.NewScheme()
+	require.NoError(t, v1alpha1.AddToScheme(scheme))
+	reconciler := &TalosMachineReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(workerCluster()).Build(),
+	}
+
+	machine := &v1alpha1.Machine{
+		ObjectMeta: metav1.ObjectMeta{Name: "m1", Namespace: "machines", Labels: map[string]string{"role": "worker"}},
+		Spec:       v1alpha1.MachineSpec{Maintenance: &v1alpha1.MachineMaintenance{}},
+	}
+
+	cluster, err := reconciler.claimingCluster(ctx, machine)
+	require.NoError(t, err)
+	assert.Empty(t, cluster, "unclaimed machines in maintenance are not claimed")
+
+	machine.Status.Cluster = "default/c1"
+	cluster, err = reconciler.claimingCluster(ctx, machine)
+	require.NoError(t, err)
+	assert.Equal(t, "default/c1", cluster, "machines in maintenance stay with their cluster")
+}
+
+func TestEvictable(t *testing.T) {
+	daemonSet := metav1.OwnerReference{Kind: "DaemonSet", Name: "cilium", Controller: ptr.To(true)}
+
+	assert.True(t, evictable(&corev1.Pod{}))
+	assert.False(t, evictable(&corev1.Pod{ObjectMeta: metav1.ObjectMeta{OwnerReferences: []metav1.OwnerReference{daemonSet}}}))
+	assert.False(t, evictable(&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{corev1.MirrorPodAnnotationKey: "x"}}}))
+	assert.False(t, evictable(&corev1.Pod{Status: corev1.PodStatus{Phase: corev1.PodSucceeded}}))
+}
@@ -0,0 +1,121 @@
+package operator
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/lukaspj/talos-cluster-operator/pkg/api/v1alpha1"
+	"github.com/lukaspj/talos-cluster-operator/pkg/conditions"
+	"github.com/prometheus/client_golang/prometheus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const metricsNamespace = "talos_operator"
+
+var (
+	machineProbeDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "machine_probe_duration_seconds",
+		Help:      "Duration of the connectivity test of the Talos API of machines.",
+		Buckets:   []float64{.001, .005, .01, .05, .1, .5, 1, 5, 10, 30},
+	}, []string{"result"})
+
+	talosCallDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "talos_api_call_duration_seconds",
+		Help:      "Duration of Talos API calls made by the operator.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"call"})
+
+	talosCallErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "talos_api_call_errors_total",
+		Help:      "Number of failed Talos API calls made by the operator.",
+	}, []string{"call"})
+)
+
+// RegisterMetrics registers the operator metrics with the controller-runtime registry, which the manager serves.
+// Machine and Cluster gauges are computed from the reader on every scrape.
+func RegisterMetrics(c client.Reader) {
+	metrics.Registry.MustRegister(machineProbeDuration, talosCallDuration, talosCallErrors, &objectCollector{client: c})
+}
+
+// observeTalosCall records the duration and outcome of a Talos API call.
+func observeTalosCall(call string, f func() error) error {
+	start := time.Now()
+	err := f()
+	talosCallDuration.WithLabelValues(call).Observe(time.Since(start).Seconds())
+	if err != nil {
+		talosCallErrors.WithLabelValues(call).Inc()
+	}
+
+	return err
+}
+
+var (
+	machinesDesc = prometheus.NewDesc(metricsNamespace+"_machines",
+		"Number of machines by condition and condition status.", []string{"condition", "status"}, nil)
+	clusterPhaseDesc = prometheus.NewDesc(metricsNamespace+"_cluster_phase",
+		"Phase of every cluster, derived from its Ready condition; the gauge of the current phase is 1.", []string{"namespace", "cluster", "phase"}, nil)
+)
+
+var clusterPhases = []string{"Pending", "Ready", "Failed"}
+
+type objectCollector struct {
+	client client.Reader
+}
+
+func (o *objectCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- machinesDesc
+	ch <- clusterPhaseDesc
+}
+
+func (o *objectCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	machines := &v1alpha1.MachineList{}
+	if err := o.client.List(ctx, machines); err != nil {
+		slog.Error("unable to list machines for metrics", "error", err)
+	}
+	type key struct{ condition, status string }
+	counts := map[key]int{}
+	for _, machine := range machines.Items {
+		for _, condition := range machine.Status.Conditions {
+			counts[key{condition.Type, string(condition.Status)}]++
+		}
+	}
+	for k, count := range counts {
+		ch <- prometheus.MustNewConstMetric(machinesDesc, prometheus.GaugeValue, float64(count), k.condition, k.status)
+	}
+
+	clusters := &v1alpha1.ClusterList{}
+	if err := o.client.List(ctx, clusters); err != nil {
+		slog.Error("unable to list clusters for metrics", "error", err)
+	}
+	for _, cluster := range clusters.Items {
+		current := clusterPhase(&cluster)
+		for _, phase := range clusterPhases {
+			value := 0.0
+			if phase == current {
+				value = 1
+			}
+			ch <- prometheus.MustNewConstMetric(clusterPhaseDesc, prometheus.GaugeValue, value, cluster.Namespace, cluster.Name, phase)
+		}
+	}
+}
+
+func clusterPhase(cluster *v1alpha1.Cluster) string {
+	ready := conditions.Get(cluster, conditions.Ready)
+	switch {
+	case ready == nil || ready.Status == metav1.ConditionUnknown:
+		return "Pending"
+	case ready.Status == metav1.ConditionTrue:
+		return "Ready"
+	default:
+		return "Failed"
+	}
+}
@@ -0,0 +1,45 @@
+package operator
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/lukaspj/talos-cluster-operator/pkg/api/v1alpha1"
+	"github.com/lukaspj/talos-cluster-operator/pkg/conditions"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestObjectCollector(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, v1alpha1.AddToScheme(scheme))
+
+	available := func(status metav1.ConditionStatus) []metav1.Condition {
+		return []metav1.Condition{{Type: v1alpha1.MachineAvailableCondition, Status: status}}
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&v1alpha1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "a", Namespace: "machines"}, Status: v1alpha1.MachineStatus{Conditions: available(metav1.ConditionTrue)}},
+		&v1alpha1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "b", Namespace: "machines"}, Status: v1alpha1.MachineStatus{Conditions: available(metav1.ConditionTrue)}},
+		&v1alpha1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "c", Namespace: "machines"}, Status: v1alpha1.MachineStatus{Conditions: available(metav1.ConditionFalse)}},
+		&v1alpha1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "prod", Namespace: "default"}, Status: v1alpha1.ClusterStatus{
+			Conditions: []metav1.Condition{{Type: conditions.Ready, Status: metav1.ConditionTrue}},
+		}},
+	).Build()
+
+	expected := `
+# HELP talos_operator_machines Number of machines by condition and condition status.
+# TYPE talos_operator_machines gauge
+talos_operator_machines{condition="Available",status="False"} 1
+talos_operator_machines{condition="Available",status="True"} 2
+# HELP talos_operator_cluster_phase Phase of every cluster, derived from its Ready condition; the gauge of the current phase is 1.
+# TYPE talos_operator_cluster_phase gauge
+talos_operator_cluster_phase{cluster="prod",namespace="default",phase="Failed"} 0
+talos_operator_cluster_phase{cluster="prod",namespace="default",phase="Pending"} 0
+talos_operator_cluster_phase{cluster="prod",namespace="default",phase="Ready"} 1
+`
+	assert.NoError(t, testutil.CollectAndCompare(&objectCollector{client: c}, strings.NewReader(expected)))
+}
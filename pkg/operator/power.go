@@ -0,0 +1,177 @@
+package operator
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/lukaspj/talos-cluster-operator/pkg/api/v1alpha1"
+	"github.com/lukaspj/talos-cluster-operator/pkg/bmc"
+	"github.com/lukaspj/talos-cluster-operator/pkg/conditions"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// reconcilePower records which Cluster claims the machine and, for machines with a BMC, powers on claimed
+// machines, power cycles claimed machines that have been unreachable for longer than BMCRebootAfter and powers off
+// machines released by their Cluster.
+func (t *TalosMachineReconciler) reconcilePower(ctx context.Context, machine *v1alpha1.Machine) error {
+	cluster, err := t.claimingCluster(ctx, machine)
+	if err != nil {
+		return err
+	}
+
+	// Machines in maintenance are left in whatever power state maintenance put them in.
+	if machine.Spec.BMC == nil || machine.InMaintenance() {
+		if machine.Status.Cluster == cluster {
+			return nil
+		}
+		return patchStatus(ctx, t.Client, MachineControllerName, machine, func(m *v1alpha1.Machine) {
+			m.Status.Cluster = cluster
+		})
+	}
+
+	powerManaged := metav1.Condition{Type: v1alpha1.MachinePowerManagedCondition, Status: metav1.ConditionTrue}
+	var powerCycled bool
+
+	state, err := t.applyPowerPolicy(ctx, machine, cluster, &powerCycled)
+	if err != nil {
+		t.Recorder.Event(machine, "Warning", "PowerManagementFailed", err.Error())
+		powerManaged.Status = metav1.ConditionFalse
+		powerManaged.Reason = "PowerManagementFailed"
+		powerManaged.Message = err.Error()
+	} else {
+		powerManaged.Reason = "Power" + string(state)
+		powerManaged.Message = fmt.Sprintf("Machine is powered %s", state)
+	}
+
+	return patchStatus(ctx, t.Client, MachineControllerName, machine, func(m *v1alpha1.Machine) {
+		conditions.Set(m, powerManaged)
+		m.Status.Cluster = cluster
+		if powerCycled {
+			m.Status.LastPowerCycleTime = &metav1.Time{Time: time.Now()}
+		}
+	})
+}
+
+func (t *TalosMachineReconciler) applyPowerPolicy(ctx context.Context, machine *v1alpha1.Machine, cluster string, powerCycled *bool) (bmc.PowerState, error) {
+	driver, err := t.powerDriver(ctx, machine)
+	if err != nil {
+		return bmc.PowerUnknown, err
+	}
+
+	state, err := driver.PowerState(ctx)
+	if err != nil {
+		return bmc.PowerUnknown, err
+	}
+
+	switch {
+	case cluster != "" && state == bmc.PowerOff:
+		t.Recorder.Eventf(machine, "Normal", "PoweringOn", "Machine is claimed by cluster %s", cluster)
+		return bmc.PowerOn, driver.PowerOn(ctx)
+
+	case cluster == "" && machine.Status.Cluster != "" && state == bmc.PowerOn:
+		t.Recorder.Eventf(machine, "Normal", "PoweringOff", "Machine was released by cluster %s", machine.Status.Cluster)
+		return bmc.PowerOff, driver.PowerOff(ctx)
+
+	case cluster != "" && state == bmc.PowerOn && unreachableFor(machine) > t.Config.BMCRebootAfter:
+		t.Recorder.Eventf(machine, "Warning", "PowerCycling", "Machine has been unreachable for more than %s", t.Config.BMCRebootAfter)
+		*powerCycled = true
+		return bmc.PowerOn, driver.Reboot(ctx)
+	}
+
+	return state, nil
+}
+
+// unreachableFor returns how long the machine has been unavailable since it was last power cycled.
+func unreachableFor(machine *v1alpha1.Machine) time.Duration {
+	available := conditions.Get(machine, v1alpha1.MachineAvailableCondition)
+	if available == nil || available.Status != metav1.ConditionFalse {
+		return 0
+	}
+
+	since := available.LastTransitionTime.Time
+	if last := machine.Status.LastPowerCycleTime; last != nil && last.After(since) {
+		since = last.Time
+	}
+
+	return time.Since(since)
+}
+
+func (t *TalosMachineReconciler) powerDriver(ctx context.Context, machine *v1alpha1.Machine) (bmc.Driver, error) {
+	spec := machine.Spec.BMC
+
+	secret := &corev1.Secret{}
+	name := types.NamespacedName{Namespace: machine.Namespace, Name: spec.CredentialsRef.Name}
+	if err := t.Get(ctx, name, secret); err != nil {
+		return nil, fmt.Errorf("unable to get bmc credentials %s: %w", name, err)
+	}
+
+	return bmc.New(spec.Driver, spec.Address, bmc.Credentials{
+		Username: string(secret.Data["username"]),
+		Password: string(secret.Data["password"]),
+	}, bmc.Options{
+		SystemID:           spec.SystemID,
+		InsecureSkipVerify: spec.InsecureSkipVerify,
+	})
+}
+
+// claimingCluster returns the namespace/name of the first Cluster, by name, selecting the machine.
+func (t *TalosMachineReconciler) claimingCluster(ctx context.Context, machine *v1alpha1.Machine) (string, error) {
+	clusters := &v1alpha1.ClusterList{}
+	if err := t.List(ctx, clusters); err != nil {
+		return "", err
+	}
+
+	var claims []string
+	for _, cluster := range clusters.Items {
+		if clusterSelects(&cluster, machine) {
+			claims = append(claims, client.ObjectKeyFromObject(&cluster).String())
+		}
+	}
+	if len(claims) == 0 {
+		return "", nil
+	}
+
+	// Machines in maintenance stay with the Cluster they are part of but are not claimed by others.
+	if machine.InMaintenance() {
+		if slices.Contains(claims, machine.Status.Cluster) {
+			return machine.Status.Cluster, nil
+		}
+		return "", nil
+	}
+
+	return slices.Min(claims), nil
+}
+
+// machinesForCluster maps a Cluster to the Machines its MachineSets select, so claims are re-evaluated when the
+// selectors change.
+func (t *TalosMachineReconciler) machinesForCluster(ctx context.Context, obj client.Object) []reconcile.Request {
+	cluster, ok := obj.(*v1alpha1.Cluster)
+	if !ok {
+		return nil
+	}
+
+	machines := &v1alpha1.MachineList{}
+	if err := t.List(ctx, machines, client.InNamespace(cluster.MachinesNamespace())); err != nil {
+		slog.Error("unable to list machines", "error", err)
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, machine := range machines.Items {
+		if !t.Config.Watches(machine.Namespace) {
+			continue
+		}
+		if clusterSelects(cluster, &machine) || machine.Status.Cluster == client.ObjectKeyFromObject(cluster).String() {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&machine)})
+		}
+	}
+
+	return requests
+}
@@ -0,0 +1,158 @@
+package operator
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lukaspj/talos-cluster-operator/pkg/api/v1alpha1"
+	"github.com/lukaspj/talos-cluster-operator/pkg/bmc/redfishmock"
+	"github.com/lukaspj/talos-cluster-operator/pkg/conditions"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newPowerManagedMachine(t *testing.T, redfish *redfishmock.Server, objs ...client.Object) (*TalosMachineReconciler, *v1alpha1.Machine) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, corev1.AddToScheme(scheme))
+	require.NoError(t, v1alpha1.AddToScheme(scheme))
+
+	machine := &v1alpha1.Machine{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "m1",
+			Namespace: "machines",
+			Labels:    map[string]string{"role": "worker"},
+		},
+		Spec: v1alpha1.MachineSpec{
+			IP: "10.0.0.1",
+			BMC: &v1alpha1.MachineBMC{
+				Address:            strings.TrimPrefix(redfish.URL, "https://"),
+				Driver:             "redfish",
+				CredentialsRef:     corev1.LocalObjectReference{Name: "bmc"},
+				InsecureSkipVerify: true,
+			},
+		},
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "bmc", Namespace: "machines"},
+		Data:       map[string][]byte{"username": []byte("admin"), "password": []byte("secret")},
+	}
+
+	c := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithStatusSubresource(&v1alpha1.Machine{}).
+		WithObjects(append(objs, machine, secret)...).
+		Build()
+
+	reconciler := &TalosMachineReconciler{
+		Client:   c,
+		Scheme:   scheme,
+		Recorder: record.NewFakeRecorder(10),
+		Config:   DefaultConfig(),
+	}
+
+	return reconciler, machine
+}
+
+func workerCluster() *v1alpha1.Cluster {
+	return &v1alpha1.Cluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "c1", Namespace: "default"},
+		Spec: v1alpha1.ClusterSpec{
+			MachineNamespace: "machines",
+			Nodes: v1alpha1.MachineSet{
+				Name:     "control-plane",
+				Selector: metav1.LabelSelector{MatchLabels: map[string]string{"role": "control-plane"}},
+			},
+			WorkerSets: []v1alpha1.MachineSet{{
+				Name:     "workers",
+				Selector: metav1.LabelSelector{MatchLabels: map[string]string{"role": "worker"}},
+			}},
+		},
+	}
+}
+
+func TestTalosMachineReconciler_reconcilePower(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("claimed machine is powered on", func(t *testing.T) {
+		redfish := redfishmock.New("admin", "secret")
+		defer redfish.Close()
+
+		reconciler, machine := newPowerManagedMachine(t, redfish, workerCluster())
+		require.NoError(t, reconciler.reconcilePower(ctx, machine))
+
+		assert.Equal(t, []string{"On"}, redfish.Resets())
+
+		got := &v1alpha1.Machine{}
+		require.NoError(t, reconciler.Get(ctx, client.ObjectKeyFromObject(machine), got))
+		assert.Equal(t, "default/c1", got.Status.Cluster)
+		assert.True(t, conditions.IsTrue(got, v1alpha1.MachinePowerManagedCondition))
+	})
+
+	t.Run("released machine is powered off", func(t *testing.T) {
+		redfish := redfishmock.New("admin", "secret")
+		defer redfish.Close()
+		redfish.SetPowerState("On")
+
+		reconciler, machine := newPowerManagedMachine(t, redfish)
+		machine.Status.Cluster = "default/c1"
+		require.NoError(t, reconciler.Status().Update(ctx, machine))
+
+		require.NoError(t, reconciler.reconcilePower(ctx, machine))
+
+		assert.Equal(t, []string{"ForceOff"}, redfish.Resets())
+
+		got := &v1alpha1.Machine{}
+		require.NoError(t, reconciler.Get(ctx, client.ObjectKeyFromObject(machine), got))
+		assert.Empty(t, got.Status.Cluster)
+	})
+
+	t.Run("unreachable claimed machine is power cycled", func(t *testing.T) {
+		redfish := redfishmock.New("admin", "secret")
+		defer redfish.Close()
+		redfish.SetPowerState("On")
+
+		reconciler, machine := newPowerManagedMachine(t, redfish, workerCluster())
+		machine.Status.Cluster = "default/c1"
+		machine.Status.Conditions = []metav1.Condition{{
+			Type:               v1alpha1.MachineAvailableCondition,
+			Status:             metav1.ConditionFalse,
+			Reason:             "Unreachable",
+			LastTransitionTime: metav1.NewTime(time.Now().Add(-time.Hour)),
+		}}
+		require.NoError(t, reconciler.Status().Update(ctx, machine))
+
+		require.NoError(t, reconciler.reconcilePower(ctx, machine))
+		assert.Equal(t, []string{"ForceRestart"}, redfish.Resets())
+
+		got := &v1alpha1.Machine{}
+		require.NoError(t, reconciler.Get(ctx, client.ObjectKeyFromObject(machine), got))
+		require.NotNil(t, got.Status.LastPowerCycleTime)
+
+		// The power cycle restarts the reboot timer.
+		require.NoError(t, reconciler.reconcilePower(ctx, got))
+		assert.Equal(t, []string{"ForceRestart"}, redfish.Resets())
+	})
+
+	t.Run("missing credentials mark power management failed", func(t *testing.T) {
+		redfish := redfishmock.New("admin", "secret")
+		defer redfish.Close()
+
+		reconciler, machine := newPowerManagedMachine(t, redfish, workerCluster())
+		machine.Spec.BMC.CredentialsRef.Name = "missing"
+
+		require.NoError(t, reconciler.reconcilePower(ctx, machine))
+		assert.Empty(t, redfish.Resets())
+
+		got := &v1alpha1.Machine{}
+		require.NoError(t, reconciler.Get(ctx, client.ObjectKeyFromObject(machine), got))
+		assert.True(t, conditions.IsFalse(got, v1alpha1.MachinePowerManagedCondition))
+	})
+}
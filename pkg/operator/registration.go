@@ -0,0 +1,39 @@
+package operator
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/lukaspj/talos-cluster-operator/pkg/api/v1alpha1"
+	"github.com/lukaspj/talos-cluster-operator/pkg/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// reconcileRegistration completes the registration of a pending Machine once it is reachable on its assigned
+// address, and deletes it when it does not report in within the registration timeout. It reports whether the
+// Machine was deleted.
+func (t *TalosMachineReconciler) reconcileRegistration(ctx context.Context, machine *v1alpha1.Machine) (bool, error) {
+	if !machine.RegistrationPending() {
+		return false, nil
+	}
+
+	if conditions.IsTrue(machine, v1alpha1.MachineAvailableCondition) {
+		t.Recorder.Event(machine, "Normal", "Registered", "Machine reported in on its assigned address")
+		return false, patchStatus(ctx, t.Client, MachineControllerName, machine, func(m *v1alpha1.Machine) {
+			m.Status.Phase = v1alpha1.MachinePhaseRegistered
+		})
+	}
+
+	pendingFor := time.Since(machine.CreationTimestamp.Time)
+	if pendingFor < t.Config.RegistrationTimeout {
+		return false, nil
+	}
+
+	slog.Info("deleting stale pending registration", "machine", client.ObjectKeyFromObject(machine), "pendingFor", pendingFor)
+	t.Recorder.Event(machine, "Warning", "RegistrationExpired",
+		fmt.Sprintf("Machine did not report in within %s of being handed its config", t.Config.RegistrationTimeout))
+
+	return true, client.IgnoreNotFound(t.Delete(ctx, machine))
+}
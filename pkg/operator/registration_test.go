@@ -0,0 +1,79 @@
+package operator
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lukaspj/talos-cluster-operator/pkg/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestTalosMachineReconciler_reconcileRegistration(t *testing.T) {
+	tests := []struct {
+		name      string
+		available metav1.ConditionStatus
+		age       time.Duration
+		phase     v1alpha1.MachinePhase
+		deleted   bool
+	}{
+		{name: "reported in", available: metav1.ConditionTrue, age: time.Hour, phase: v1alpha1.MachinePhaseRegistered},
+		{name: "waiting", available: metav1.ConditionFalse, age: time.Minute, phase: v1alpha1.MachinePhasePending},
+		{name: "expired", available: metav1.ConditionFalse, age: time.Hour, deleted: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			scheme := runtime.NewScheme()
+			require.NoError(t, v1alpha1.AddToScheme(scheme))
+
+			machine := &v1alpha1.Machine{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:              "m1",
+					Namespace:         "machines",
+					CreationTimestamp: metav1.NewTime(time.Now().Add(-tt.age)),
+				},
+				Spec: v1alpha1.MachineSpec{IP: "10.0.0.1"},
+			}
+			c := fake.NewClientBuilder().
+				WithScheme(scheme).
+				WithStatusSubresource(&v1alpha1.Machine{}).
+				WithObjects(machine).
+				Build()
+			machine.Status.Phase = v1alpha1.MachinePhasePending
+			machine.Status.Conditions = []metav1.Condition{{
+				Type: v1alpha1.MachineAvailableCondition, Status: tt.available, Reason: "Test", LastTransitionTime: metav1.Now(),
+			}}
+			require.NoError(t, c.Status().Update(ctx, machine))
+
+			reconciler := &TalosMachineReconciler{
+				Client:   c,
+				Scheme:   scheme,
+				Recorder: record.NewFakeRecorder(10),
+				Config:   DefaultConfig(),
+				Talos:    &fakeMachineAPI{},
+			}
+
+			deleted, err := reconciler.reconcileRegistration(ctx, machine)
+			require.NoError(t, err)
+			assert.Equal(t, tt.deleted, deleted)
+
+			got := &v1alpha1.Machine{}
+			err = c.Get(ctx, client.ObjectKeyFromObject(machine), got)
+			if tt.deleted {
+				assert.True(t, k8serrors.IsNotFound(err))
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.phase, got.Status.Phase)
+		})
+	}
+}
@@ -0,0 +1,216 @@
+package operator
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/lukaspj/talos-cluster-operator/pkg/api/v1alpha1"
+	"github.com/lukaspj/talos-cluster-operator/pkg/conditions"
+	"github.com/lukaspj/talos-cluster-operator/pkg/imagefactory"
+	talosctl "github.com/siderolabs/talos/pkg/machinery/client"
+	"google.golang.org/protobuf/types/known/emptypb"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// reconcileSchematics registers the schematic of every MachineSet with the Image Factory and returns the installer
+// image of each.
+func (t *TalosClusterReconciler) reconcileSchematics(ctx context.Context, cluster *v1alpha1.Cluster) ([]v1alpha1.MachineSetStatus, metav1.Condition) {
+	condition := metav1.Condition{
+		Type:    v1alpha1.ClusterSchematicsCondition,
+		Status:  metav1.ConditionTrue,
+		Reason:  "SchematicsRegistered",
+		Message: "Schematics of every MachineSet are registered",
+	}
+
+	var statuses []v1alpha1.MachineSetStatus
+	var failed []string
+	for _, set := range cluster.Spec.MachineSets() {
+		if set.Schematic == nil {
+			continue
+		}
+
+		id, err := t.Factory.Register(ctx, factorySchematic(set.Schematic))
+		if err != nil {
+			t.Recorder.Eventf(cluster, "Warning", "SchematicRegistrationFailed", "MachineSet %s: %s", set.Name, err)
+			failed = append(failed, fmt.Sprintf("%s: %s", set.Name, err))
+			continue
+		}
+
+		version := set.TalosVersion
+		if version == "" {
+			version = t.Config.TalosVersion
+		}
+		statuses = append(statuses, v1alpha1.MachineSetStatus{
+			Name:           set.Name,
+			SchematicID:    id,
+			InstallerImage: imagefactory.InstallerImage(t.Config.ImageFactoryRegistry, id, version),
+		})
+	}
+
+	if len(failed) > 0 {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "SchematicRegistrationFailed"
+		condition.Message = strings.Join(failed, "; ")
+	}
+
+	return statuses, condition
+}
+
+func factorySchematic(schematic *v1alpha1.Schematic) imagefactory.Schematic {
+	s := imagefactory.Schematic{
+		Customization: imagefactory.Customization{
+			ExtraKernelArgs: schematic.ExtraKernelArgs,
+			SystemExtensions: imagefactory.SystemExtensions{
+				OfficialExtensions: slices.Sorted(slices.Values(schematic.Extensions)),
+			},
+		},
+	}
+	if schematic.Overlay != nil {
+		s.Overlay = &imagefactory.Overlay{Image: schematic.Overlay.Image, Name: schematic.Overlay.Name}
+	}
+
+	return s
+}
+
+// installer is the part of the Talos API of a cluster the installer image rollout uses, addressed per node.
+type installer interface {
+	// Upgrade upgrades the node to the installer image, preserving its data, and reboots it.
+	Upgrade(ctx context.Context, node, image string) error
+	// Boot reports when the node booted and the Talos version it runs.
+	Boot(ctx context.Context, node string) (time.Time, string, error)
+}
+
+// talosInstaller talks to the nodes through the Talos API of their cluster.
+type talosInstaller struct {
+	ctl *talosctl.Client
+}
+
+func (i *talosInstaller) Upgrade(ctx context.Context, node, image string) error {
+	_, err := i.ctl.UpgradeWithOptions(talosctl.WithNode(ctx, node),
+		talosctl.WithUpgradeImage(image), talosctl.WithUpgradePreserve(true))
+	return err
+}
+
+func (i *talosInstaller) Boot(ctx context.Context, node string) (time.Time, string, error) {
+	ctx = talosctl.WithNode(ctx, node)
+	stat, err := i.ctl.MachineClient.SystemStat(ctx, &emptypb.Empty{})
+	if err != nil {
+		return time.Time{}, "", err
+	}
+	version, err := i.ctl.Version(ctx)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+	if len(stat.Messages) == 0 || len(version.Messages) == 0 {
+		return time.Time{}, "", fmt.Errorf("no response from node %s", node)
+	}
+
+	return time.Unix(int64(stat.Messages[0].BootTime), 0), version.Messages[0].Version.Tag, nil
+}
+
+// rolloutInstallerImages upgrades the machines of the cluster to the installer image of their MachineSet, one at a
+// time. It must only be called while the cluster is healthy. A machine is only upgraded once the previous one booted
+// again on its new version, and only machines which are available and part of the cluster are upgraded. It reports
+// whether any machine is still being or to be upgraded.
+func (t *TalosClusterReconciler) rolloutInstallerImages(ctx context.Context, api installer, cluster *v1alpha1.Cluster, statuses []v1alpha1.MachineSetStatus) (bool, error) {
+	targets, err := t.rolloutTargets(ctx, cluster, statuses)
+	if err != nil {
+		return false, err
+	}
+
+	for _, target := range targets {
+		if target.machine.Status.Upgrade != nil {
+			return true, t.awaitUpgrade(ctx, api, cluster, &target.machine)
+		}
+	}
+
+	for _, target := range targets {
+		machine := &target.machine
+		if machine.Status.InstallerImage == target.image || machine.InMaintenance() || machine.RegistrationPending() ||
+			!conditions.IsTrue(machine, v1alpha1.MachineAvailableCondition) {
+			continue
+		}
+
+		t.Recorder.Eventf(cluster, "Normal", "UpgradingMachine", "Upgrading %s to %s", machine.Name, target.image)
+		start := metav1.Now()
+		err := observeTalosCall("upgrade", func() error { return api.Upgrade(ctx, machine.Spec.IP, target.image) })
+		if err != nil {
+			return true, fmt.Errorf("unable to upgrade machine %s: %w", machine.Name, err)
+		}
+
+		return true, patchStatus(ctx, t.Client, ClusterControllerName, machine, func(m *v1alpha1.Machine) {
+			m.Status.Upgrade = &v1alpha1.MachineUpgrade{Image: target.image, StartTime: start}
+		})
+	}
+
+	return false, nil
+}
+
+// rolloutTarget is a machine along with the installer image of its MachineSet.
+type rolloutTarget struct {
+	machine v1alpha1.Machine
+	image   string
+}
+
+// rolloutTargets returns the machines claimed by the cluster, sorted by name, with the installer image of the first
+// of its MachineSets selecting each.
+func (t *TalosClusterReconciler) rolloutTargets(ctx context.Context, cluster *v1alpha1.Cluster, statuses []v1alpha1.MachineSetStatus) ([]rolloutTarget, error) {
+	key := client.ObjectKeyFromObject(cluster).String()
+	var targets []rolloutTarget
+	for _, set := range cluster.Spec.MachineSets() {
+		i := slices.IndexFunc(statuses, func(s v1alpha1.MachineSetStatus) bool { return s.Name == set.Name })
+		if i < 0 {
+			continue
+		}
+
+		machines, err := listMachineSet(ctx, t.Client, t.Config, cluster, &set)
+		if err != nil {
+			return nil, err
+		}
+		for _, machine := range machines {
+			// Machines selected by several sets or Clusters are upgraded once, by the set and Cluster claiming them.
+			if machine.Status.Cluster != key || machineSetFor(cluster, &machine).Name != set.Name ||
+				!machine.DeletionTimestamp.IsZero() {
+				continue
+			}
+			targets = append(targets, rolloutTarget{machine: machine, image: statuses[i].InstallerImage})
+		}
+	}
+	slices.SortFunc(targets, func(a, b rolloutTarget) int { return strings.Compare(a.machine.Name, b.machine.Name) })
+
+	return targets, nil
+}
+
+// awaitUpgrade completes the upgrade of the machine once it booted again, after the upgrade was issued, on the
+// version of the installer image. A machine which cannot be reached is still rebooting.
+func (t *TalosClusterReconciler) awaitUpgrade(ctx context.Context, api installer, cluster *v1alpha1.Cluster, machine *v1alpha1.Machine) error {
+	upgrade := machine.Status.Upgrade
+	bootTime, version, err := api.Boot(ctx, machine.Spec.IP)
+	if err != nil {
+		slog.Info("waiting for upgraded machine", "machine", machine.Name, "error", err)
+		return nil
+	}
+	if !bootTime.After(upgrade.StartTime.Time) || version != imageVersion(upgrade.Image) {
+		return nil
+	}
+
+	t.Recorder.Eventf(cluster, "Normal", "UpgradedMachine", "Upgraded %s to %s", machine.Name, upgrade.Image)
+	return patchStatus(ctx, t.Client, ClusterControllerName, machine, func(m *v1alpha1.Machine) {
+		m.Status.InstallerImage = upgrade.Image
+		m.Status.Upgrade = nil
+	})
+}
+
+// imageVersion returns the tag of an installer image, which is the Talos version it installs.
+func imageVersion(image string) string {
+	if i := strings.LastIndexAny(image, ":/"); i >= 0 && image[i] == ':' {
+		return image[i+1:]
+	}
+
+	return ""
+}
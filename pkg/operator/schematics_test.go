@@ -0,0 +1,233 @@
+package operator
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lukaspj/talos-cluster-operator/pkg/api/v1alpha1"
+	"github.com/lukaspj/talos-cluster-operator/pkg/conditions"
+	"github.com/lukaspj/talos-cluster-operator/pkg/imagefactory"
+	"github.com/lukaspj/talos-cluster-operator/pkg/imagefactory/factorymock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestTalosClusterReconciler_reconcileSchematics(t *testing.T) {
+	ctx := context.Background()
+	factory := factorymock.New()
+	defer factory.Close()
+
+	config := DefaultConfig()
+	config.TalosVersion = "v1.11.3"
+	reconciler := &TalosClusterReconciler{
+		Recorder: record.NewFakeRecorder(10),
+		Factory:  imagefactory.NewClient(factory.URL),
+		Config:   config,
+	}
+
+	cluster := &v1alpha1.Cluster{
+		Spec: v1alpha1.ClusterSpec{
+			Nodes: v1alpha1.MachineSet{Name: "control-plane"},
+			WorkerSets: []v1alpha1.MachineSet{
+				{
+					Name:      "storage",
+					Schematic: &v1alpha1.Schematic{Extensions: []string{"siderolabs/iscsi-tools"}},
+				},
+				{
+					Name:         "edge",
+					TalosVersion: "v1.10.0",
+					Schematic: &v1alpha1.Schematic{
+						ExtraKernelArgs: []string{"console=ttyS0"},
+						Overlay:         &v1alpha1.SchematicOverlay{Image: "siderolabs/sbc-raspberrypi", Name: "rpi_generic"},
+					},
+				},
+			},
+		},
+	}
+
+	statuses, condition := reconciler.reconcileSchematics(ctx, cluster)
+	assert.Equal(t, metav1.ConditionTrue, condition.Status)
+	require.Len(t, statuses, 2)
+
+	assert.Equal(t, "storage", statuses[0].Name)
+	assert.Equal(t, "factory.talos.dev/installer/"+statuses[0].SchematicID+":v1.11.3", statuses[0].InstallerImage)
+	schematic, ok := factory.Schematic(statuses[0].SchematicID)
+	require.True(t, ok)
+	assert.Contains(t, string(schematic), "siderolabs/iscsi-tools")
+
+	assert.Equal(t, "edge", statuses[1].Name)
+	assert.True(t, strings.HasSuffix(statuses[1].InstallerImage, ":v1.10.0"))
+
+	t.Run("unreachable factory", func(t *testing.T) {
+		reconciler.Factory = imagefactory.NewClient("http://127.0.0.1:0")
+
+		statuses, condition := reconciler.reconcileSchematics(ctx, cluster)
+		assert.Empty(t, statuses)
+		assert.Equal(t, metav1.ConditionFalse, condition.Status)
+		assert.Contains(t, condition.Message, "storage")
+		assert.Contains(t, condition.Message, "edge")
+	})
+}
+
+// fakeInstaller stands in for the Talos API of a cluster. Nodes without a boot are unreachable.
+type fakeInstaller struct {
+	upgrades []string
+	boots    map[string]fakeBoot
+}
+
+type fakeBoot struct {
+	time    time.Time
+	version string
+}
+
+func (f *fakeInstaller) Upgrade(_ context.Context, node, image string) error {
+	f.upgrades = append(f.upgrades, node+"="+image)
+	delete(f.boots, node)
+	return nil
+}
+
+func (f *fakeInstaller) Boot(_ context.Context, node string) (time.Time, string, error) {
+	boot, ok := f.boots[node]
+	if !ok {
+		return time.Time{}, "", errors.New("connection refused")
+	}
+	return boot.time, boot.version, nil
+}
+
+func TestTalosClusterReconciler_rolloutInstallerImages(t *testing.T) {
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	require.NoError(t, v1alpha1.AddToScheme(scheme))
+
+	const (
+		controlPlaneImage = "factory.talos.dev/installer/cp:v1.11.3"
+		workerImage       = "factory.talos.dev/installer/worker:v1.11.3"
+	)
+	cluster := &v1alpha1.Cluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "c1", Namespace: "default"},
+		Spec: v1alpha1.ClusterSpec{
+			Nodes: v1alpha1.MachineSet{
+				Name:     "control-plane",
+				Selector: metav1.LabelSelector{MatchLabels: map[string]string{"role": "control-plane"}},
+			},
+			WorkerSets: []v1alpha1.MachineSet{
+				{Name: "workers", Selector: metav1.LabelSelector{MatchLabels: map[string]string{"role": "worker"}}},
+				{Name: "gpu", Selector: metav1.LabelSelector{MatchLabels: map[string]string{"gpu": "true"}}},
+			},
+		},
+	}
+	statuses := []v1alpha1.MachineSetStatus{
+		{Name: "control-plane", InstallerImage: controlPlaneImage},
+		{Name: "workers", InstallerImage: workerImage},
+		{Name: "gpu", InstallerImage: "factory.talos.dev/installer/gpu:v1.11.3"},
+	}
+
+	machine := func(name, ip string, labels map[string]string, mutate func(*v1alpha1.Machine)) *v1alpha1.Machine {
+		m := &v1alpha1.Machine{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Labels: labels},
+			Spec:       v1alpha1.MachineSpec{IP: ip},
+			Status:     v1alpha1.MachineStatus{Cluster: "default/c1", Phase: v1alpha1.MachinePhaseRegistered},
+		}
+		conditions.MarkTrue(m, v1alpha1.MachineAvailableCondition, "Reachable", "")
+		if mutate != nil {
+			mutate(m)
+		}
+		return m
+	}
+	controlPlane := map[string]string{"role": "control-plane"}
+	objects := []client.Object{
+		machine("cp-1", "10.0.0.1", controlPlane, nil),
+		machine("cp-2", "10.0.0.2", controlPlane, nil),
+		machine("cp-3", "10.0.0.3", controlPlane, func(m *v1alpha1.Machine) {
+			conditions.MarkFalse(m, v1alpha1.MachineAvailableCondition, "Unreachable", "")
+		}),
+		machine("worker-1", "10.0.0.11", map[string]string{"role": "worker", "gpu": "true"}, nil),
+		machine("worker-2", "10.0.0.12", map[string]string{"role": "worker"}, func(m *v1alpha1.Machine) {
+			m.Status.Phase = v1alpha1.MachinePhasePending
+		}),
+		machine("worker-3", "10.0.0.13", map[string]string{"role": "worker"}, func(m *v1alpha1.Machine) {
+			m.Status.Cluster = "default/other"
+		}),
+		machine("worker-4", "10.0.0.14", map[string]string{"role": "worker"}, func(m *v1alpha1.Machine) {
+			m.Status.InstallerImage = workerImage
+		}),
+	}
+
+	c := fake.NewClientBuilder().WithScheme(scheme).WithStatusSubresource(&v1alpha1.Machine{}).WithObjects(objects...).Build()
+	reconciler := &TalosClusterReconciler{Client: c, Scheme: scheme, Recorder: record.NewFakeRecorder(100)}
+	talos := &fakeInstaller{boots: map[string]fakeBoot{}}
+
+	rollout := func() bool {
+		t.Helper()
+		pending, err := reconciler.rolloutInstallerImages(ctx, talos, cluster, statuses)
+		require.NoError(t, err)
+		return pending
+	}
+	get := func(name string) *v1alpha1.Machine {
+		t.Helper()
+		m := &v1alpha1.Machine{}
+		require.NoError(t, c.Get(ctx, client.ObjectKey{Namespace: "default", Name: name}, m))
+		return m
+	}
+	reboot := func(node, version string) {
+		talos.boots[node] = fakeBoot{time: time.Now().Add(time.Minute), version: version}
+	}
+
+	assert.True(t, rollout())
+	assert.Equal(t, []string{"10.0.0.1=" + controlPlaneImage}, talos.upgrades)
+	upgrade := get("cp-1").Status.Upgrade
+	require.NotNil(t, upgrade)
+	assert.Equal(t, controlPlaneImage, upgrade.Image)
+	assert.Empty(t, get("cp-1").Status.InstallerImage)
+
+	t.Run("waits for the upgraded machine to reboot", func(t *testing.T) {
+		assert.True(t, rollout())
+		talos.boots["10.0.0.1"] = fakeBoot{time: time.Now().Add(-time.Hour), version: "v1.11.3"}
+		assert.True(t, rollout())
+		reboot("10.0.0.1", "v1.10.0")
+		assert.True(t, rollout())
+		assert.Len(t, talos.upgrades, 1, "no machine is upgraded while the previous one is not back")
+		assert.NotNil(t, get("cp-1").Status.Upgrade)
+	})
+
+	t.Run("completes the upgrade on the target version", func(t *testing.T) {
+		reboot("10.0.0.1", "v1.11.3")
+		assert.True(t, rollout())
+		m := get("cp-1")
+		assert.Nil(t, m.Status.Upgrade)
+		assert.Equal(t, controlPlaneImage, m.Status.InstallerImage)
+		assert.Len(t, talos.upgrades, 1)
+	})
+
+	t.Run("upgrades the remaining machines once", func(t *testing.T) {
+		assert.True(t, rollout())
+		reboot("10.0.0.2", "v1.11.3")
+		assert.True(t, rollout())
+		assert.True(t, rollout())
+		reboot("10.0.0.11", "v1.11.3")
+		assert.True(t, rollout())
+		assert.False(t, rollout())
+
+		// Unavailable, pending and machines of other Clusters are skipped, machines selected by several sets get the
+		// image of the first.
+		assert.Equal(t, []string{
+			"10.0.0.1=" + controlPlaneImage,
+			"10.0.0.2=" + controlPlaneImage,
+			"10.0.0.11=" + workerImage,
+		}, talos.upgrades)
+	})
+}
+
+func TestImageVersion(t *testing.T) {
+	assert.Equal(t, "v1.11.3", imageVersion("factory.talos.dev/installer/abc:v1.11.3"))
+	assert.Equal(t, "v1.11.3", imageVersion("registry.local:5000/installer:v1.11.3"))
+	assert.Empty(t, imageVersion("registry.local:5000/installer"))
+}
@@ -0,0 +1,34 @@
+package operator
+
+import (
+	"context"
+
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	MachineControllerName = "talos-machine-controller"
+	ClusterControllerName = "talos-cluster-controller"
+)
+
+// patchStatus applies mutate to the latest version of obj and writes the status back as a merge patch owned by
+// fieldOwner. The patch carries the resourceVersion it was computed from, so a concurrent write results in a
+// conflict which is retried against a freshly read object instead of overwriting the other writer's fields.
+func patchStatus[T client.Object](ctx context.Context, c client.Client, fieldOwner string, obj T, mutate func(T)) error {
+	first := true
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		if !first {
+			if err := c.Get(ctx, client.ObjectKeyFromObject(obj), obj); err != nil {
+				return err
+			}
+		}
+		first = false
+
+		base := obj.DeepCopyObject().(T)
+		mutate(obj)
+
+		return c.Status().Patch(ctx, obj, client.MergeFromWithOptions(base, client.MergeFromWithOptimisticLock{}),
+			client.FieldOwner(fieldOwner))
+	})
+}
@@ -0,0 +1,62 @@
+package operator
+
+import (
+	"context"
+	"testing"
+
+	"github.com/lukaspj/talos-cluster-operator/pkg/api/v1alpha1"
+	"github.com/lukaspj/talos-cluster-operator/pkg/conditions"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+func TestPatchStatus(t *testing.T) {
+	ctx := context.Background()
+
+	scheme := runtime.NewScheme()
+	require.NoError(t, v1alpha1.AddToScheme(scheme))
+
+	machine := &v1alpha1.Machine{
+		ObjectMeta: metav1.ObjectMeta{Name: "m1", Namespace: "machines"},
+		Spec:       v1alpha1.MachineSpec{IP: "10.0.0.1"},
+	}
+
+	patches := 0
+	c := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithStatusSubresource(&v1alpha1.Machine{}).
+		WithObjects(machine).
+		WithInterceptorFuncs(interceptor.Funcs{
+			SubResourcePatch: func(ctx context.Context, c client.Client, subResourceName string, obj client.Object, patch client.Patch, opts ...client.SubResourcePatchOption) error {
+				patches++
+				if patches == 1 {
+					// Another writer updates the status between our read and our patch.
+					other := &v1alpha1.Machine{}
+					require.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(obj), other))
+					conditions.MarkTrue(other, "Foreign", "Other", "written concurrently")
+					require.NoError(t, c.Status().Update(ctx, other))
+				}
+				return c.SubResource(subResourceName).Patch(ctx, obj, patch, opts...)
+			},
+		}).
+		Build()
+
+	current := &v1alpha1.Machine{}
+	require.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(machine), current))
+
+	err := patchStatus(ctx, c, MachineControllerName, current, func(m *v1alpha1.Machine) {
+		conditions.MarkTrue(m, v1alpha1.MachineAvailableCondition, "ConnectivityTestSucceeded", "ok")
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, patches)
+
+	stored := &v1alpha1.Machine{}
+	require.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(machine), stored))
+	assert.True(t, conditions.IsTrue(stored, "Foreign"))
+	assert.True(t, conditions.IsTrue(stored, v1alpha1.MachineAvailableCondition))
+}
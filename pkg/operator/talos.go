@@ -0,0 +1,183 @@
+package operator
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/cosi-project/runtime/pkg/resource"
+	"github.com/cosi-project/runtime/pkg/state"
+	"github.com/lukaspj/talos-cluster-operator/pkg/api/v1alpha1"
+	"github.com/lukaspj/talos-cluster-operator/pkg/talosclient"
+	machineapi "github.com/siderolabs/talos/pkg/machinery/api/machine"
+	talosctl "github.com/siderolabs/talos/pkg/machinery/client"
+	yaml "go.yaml.in/yaml/v4"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// MachineAPI is the part of the Talos machine API the Machine reconciler uses, addressed per Machine.
+type MachineAPI interface {
+	// Reset wipes the machine according to its wipe mode and reboots it into maintenance mode.
+	Reset(ctx context.Context, machine *v1alpha1.Machine) error
+	// InMaintenance reports whether the machine is running in maintenance mode.
+	InMaintenance(ctx context.Context, machine *v1alpha1.Machine) (bool, error)
+	// MachineConfig returns the live machine config of the machine as YAML.
+	MachineConfig(ctx context.Context, machine *v1alpha1.Machine) ([]byte, error)
+	// ApplyConfiguration applies a machine config to the machine.
+	ApplyConfiguration(ctx context.Context, machine *v1alpha1.Machine, config []byte, mode v1alpha1.ConfigApplyMode) error
+	// Shutdown powers the machine off.
+	Shutdown(ctx context.Context, machine *v1alpha1.Machine) error
+}
+
+// TalosMachineAPI talks to machines using the talosconfig of the Cluster claiming them.
+type TalosMachineAPI struct {
+	Client client.Reader
+	Talos  *talosclient.Pool
+	Config Config
+}
+
+func (t *TalosMachineAPI) client(ctx context.Context, machine *v1alpha1.Machine) (*talosctl.Client, error) {
+	secretName, secretKey, err := t.talosConfigSecret(ctx, machine)
+	if err != nil {
+		return nil, err
+	}
+	credentials, err := talosclient.LoadSecretCredentials(ctx, t.Client, secretName, secretKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return t.Talos.Client(ctx, credentials, machineAddress(machine))
+}
+
+// talosConfigSecret returns the Secret and key holding the talosconfig of the Cluster claiming the machine.
+// Unclaimed machines, and machines whose Cluster is gone, use the operator-wide talosconfig.
+func (t *TalosMachineAPI) talosConfigSecret(ctx context.Context, machine *v1alpha1.Machine) (types.NamespacedName, string, error) {
+	if machine.Status.Cluster != "" {
+		namespace, name, _ := strings.Cut(machine.Status.Cluster, "/")
+		cluster := &v1alpha1.Cluster{}
+		err := t.Client.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, cluster)
+		if err == nil {
+			secretName, secretKey := t.Config.ClusterTalosConfigSecret(cluster)
+			return secretName, secretKey, nil
+		}
+		if !k8serrors.IsNotFound(err) {
+			return types.NamespacedName{}, "", err
+		}
+	}
+
+	return t.Config.TalosConfigSecret(), t.Config.ConfigSecretKey, nil
+}
+
+func (t *TalosMachineAPI) Reset(ctx context.Context, machine *v1alpha1.Machine) error {
+	ctl, err := t.client(ctx, machine)
+	if err != nil {
+		return err
+	}
+
+	mode := machineapi.ResetRequest_ALL
+	switch machine.Spec.WipeMode {
+	case v1alpha1.MachineWipeModeSystemDisk:
+		mode = machineapi.ResetRequest_SYSTEM_DISK
+	case v1alpha1.MachineWipeModeUserDisks:
+		mode = machineapi.ResetRequest_USER_DISKS
+	}
+
+	return observeTalosCall("reset", func() error {
+		return ctl.ResetGeneric(ctx, &machineapi.ResetRequest{
+			Graceful: true,
+			Reboot:   true,
+			Mode:     mode,
+		})
+	})
+}
+
+// InMaintenance connects without client certificates, which only the maintenance service accepts.
+func (t *TalosMachineAPI) InMaintenance(ctx context.Context, machine *v1alpha1.Machine) (bool, error) {
+	ctl, err := talosctl.New(ctx,
+		talosctl.WithEndpoints(machineAddress(machine)),
+		talosctl.WithTLSConfig(&tls.Config{InsecureSkipVerify: true}),
+	)
+	if err != nil {
+		return false, err
+	}
+	defer ctl.Close()
+
+	if _, err = ctl.Version(ctx); err != nil {
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// MachineConfig reads the MachineConfig resource through COSI, the same way the config server reads the config of
+// the management cluster.
+func (t *TalosMachineAPI) MachineConfig(ctx context.Context, machine *v1alpha1.Machine) ([]byte, error) {
+	ctl, err := t.client(ctx, machine)
+	if err != nil {
+		return nil, err
+	}
+
+	var r resource.Resource
+	err = observeTalosCall("get_machine_config", func() error {
+		talosNamespace := "config"
+		resourceKind, err := ctl.ResolveResourceKind(ctx, &talosNamespace, "machineconfig")
+		if err != nil {
+			return err
+		}
+
+		r, err = ctl.COSI.Get(ctx, resource.NewMetadata(talosNamespace, resourceKind.TypedSpec().Type, "v1alpha1", resource.VersionUndefined),
+			state.WithGetUnmarshalOptions(state.WithSkipProtobufUnmarshal()))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return yaml.Marshal(r.Spec())
+}
+
+func (t *TalosMachineAPI) ApplyConfiguration(ctx context.Context, machine *v1alpha1.Machine, config []byte, mode v1alpha1.ConfigApplyMode) error {
+	ctl, err := t.client(ctx, machine)
+	if err != nil {
+		return err
+	}
+
+	applyMode := machineapi.ApplyConfigurationRequest_AUTO
+	switch mode {
+	case v1alpha1.ConfigApplyModeStaged:
+		applyMode = machineapi.ApplyConfigurationRequest_STAGED
+	case v1alpha1.ConfigApplyModeNoReboot:
+		applyMode = machineapi.ApplyConfigurationRequest_NO_REBOOT
+	}
+
+	return observeTalosCall("apply_configuration", func() error {
+		_, err := ctl.ApplyConfiguration(ctx, &machineapi.ApplyConfigurationRequest{
+			Data: config,
+			Mode: applyMode,
+		})
+		return err
+	})
+}
+
+func (t *TalosMachineAPI) Shutdown(ctx context.Context, machine *v1alpha1.Machine) error {
+	ctl, err := t.client(ctx, machine)
+	if err != nil {
+		return err
+	}
+
+	return observeTalosCall("shutdown", func() error { return ctl.Shutdown(ctx) })
+}
+
+// machineAddress returns the host:port of the machine's Talos API.
+func machineAddress(machine *v1alpha1.Machine) string {
+	port := machine.Spec.Port
+	if port == 0 {
+		port = 50000
+	}
+
+	return net.JoinHostPort(machine.Spec.IP, strconv.Itoa(port))
+}
@@ -0,0 +1,62 @@
+package operator
+
+import (
+	"context"
+	"testing"
+
+	"github.com/lukaspj/talos-cluster-operator/pkg/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestTalosMachineAPI_talosConfigSecret(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, v1alpha1.AddToScheme(scheme))
+
+	config := DefaultConfig()
+	config.Namespace = "operator"
+	api := &TalosMachineAPI{
+		Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+			&v1alpha1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "shared", Namespace: "clusters"}},
+			&v1alpha1.Cluster{
+				ObjectMeta: metav1.ObjectMeta{Name: "own", Namespace: "team-a"},
+				Spec: v1alpha1.ClusterSpec{TalosConfigRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "talosconfig"},
+					Key:                  "config",
+				}},
+			},
+		).Build(),
+		Config: config,
+	}
+
+	tests := []struct {
+		name    string
+		cluster string
+		secret  types.NamespacedName
+		key     string
+	}{
+		{name: "unclaimed machine", secret: config.TalosConfigSecret(), key: config.ConfigSecretKey},
+		{name: "cluster without talosconfig", cluster: "clusters/shared", secret: config.TalosConfigSecret(), key: config.ConfigSecretKey},
+		{name: "cluster talosconfig", cluster: "team-a/own", secret: types.NamespacedName{Namespace: "team-a", Name: "talosconfig"}, key: "config"},
+		{name: "deleted cluster", cluster: "team-a/gone", secret: config.TalosConfigSecret(), key: config.ConfigSecretKey},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			machine := &v1alpha1.Machine{
+				ObjectMeta: metav1.ObjectMeta{Name: "m1", Namespace: "machines"},
+				Status:     v1alpha1.MachineStatus{Cluster: tt.cluster},
+			}
+
+			secret, key, err := api.talosConfigSecret(context.Background(), machine)
+			require.NoError(t, err)
+			assert.Equal(t, tt.secret, secret)
+			assert.Equal(t, tt.key, key)
+		})
+	}
+}
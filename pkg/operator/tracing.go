@@ -0,0 +1,36 @@
+package operator
+
+import (
+	"context"
+
+	"github.com/lukaspj/talos-cluster-operator/pkg/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var tracer = otel.Tracer("github.com/lukaspj/talos-cluster-operator/pkg/operator")
+
+// tracedReconciler wraps every reconcile in a span carrying the object and the reconcile ID controller-runtime logs.
+type tracedReconciler struct {
+	controller string
+	reconcile.Reconciler
+}
+
+func (t *tracedReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	ctx, span := tracer.Start(ctx, t.controller+" reconcile", trace.WithAttributes(
+		attribute.String("controller", t.controller),
+		attribute.String("namespace", req.Namespace),
+		attribute.String("name", req.Name),
+		attribute.String("reconcile_id", string(controller.ReconcileIDFromContext(ctx))),
+	))
+
+	result, err := t.Reconciler.Reconcile(ctx, req)
+	span.SetAttributes(attribute.Bool("requeue", !result.IsZero()))
+	tracing.End(span, err)
+
+	return result, err
+}
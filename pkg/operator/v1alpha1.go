@@ -6,164 +6,264 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
-	"maps"
 	"net"
-	"slices"
 	"time"
 
 	"github.com/lukaspj/talos-cluster-operator/pkg/api/v1alpha1"
+	"github.com/lukaspj/talos-cluster-operator/pkg/conditions"
+	"github.com/lukaspj/talos-cluster-operator/pkg/imagefactory"
+	"github.com/lukaspj/talos-cluster-operator/pkg/talosclient"
 	clusterapi "github.com/siderolabs/talos/pkg/machinery/api/cluster"
 	talosctl "github.com/siderolabs/talos/pkg/machinery/client"
+	corev1 "k8s.io/api/core/v1"
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
+// machineReadyDependents are the conditions summarised into the Ready condition of a Machine.
+var machineReadyDependents = []string{
+	v1alpha1.MachineAvailableCondition,
+}
+
 type TalosMachineReconciler struct {
 	client.Client
 	Scheme   *runtime.Scheme
 	Recorder record.EventRecorder
+	Config   Config
+	Talos    MachineAPI
+	Workload WorkloadNodes
+
+	backoff *backoff
 }
 
 func (t *TalosMachineReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	t.Recorder = mgr.GetEventRecorderFor("talos-machine-controller")
+	t.Recorder = newDedupRecorder(mgr.GetEventRecorderFor(MachineControllerName), t.Config.EventInterval)
+	t.backoff = newBackoff(t.Config.MachineBackoffBase, t.Config.MachineBackoffMax, t.Config.MachineBackoffJitter)
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&v1alpha1.Machine{}).
-		Complete(t)
+		// Neither the maintenance annotation nor the labels Clusters select Machines by bump the generation.
+		For(&v1alpha1.Machine{}, builder.WithPredicates(watched(t.Config), predicate.Or(predicate.GenerationChangedPredicate{},
+			predicate.AnnotationChangedPredicate{}, predicate.LabelChangedPredicate{}))).
+		Owns(&v1alpha1.Node{}).
+		Watches(&v1alpha1.Cluster{}, handler.EnqueueRequestsFromMapFunc(t.machinesForCluster),
+			builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Complete(&tracedReconciler{controller: MachineControllerName, Reconciler: t})
 }
 
 func (t *TalosMachineReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	machine := &v1alpha1.Machine{}
 	if err := t.Get(ctx, req.NamespacedName, machine); err != nil {
+		if k8serrors.IsNotFound(err) {
+			t.backoff.Reset(req.NamespacedName)
+		}
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
 
-	ready := true
+	if !machine.DeletionTimestamp.IsZero() {
+		return t.reconcileDelete(ctx, machine)
+	}
 
-	conditions := make(map[string]metav1.Condition)
-	for _, condition := range machine.Status.Conditions {
-		conditions[condition.Type] = condition
+	base := machine.DeepCopy()
+	if controllerutil.AddFinalizer(machine, v1alpha1.MachineFinalizer) {
+		if err := t.Patch(ctx, machine, client.MergeFromWithOptions(base, client.MergeFromWithOptimisticLock{}), client.FieldOwner(MachineControllerName)); err != nil {
+			return ctrl.Result{}, err
+		}
 	}
 
-	port := machine.Spec.Port
-	if port == 0 {
-		port = 50000
+	address := machineAddress(machine)
+	available := metav1.Condition{
+		Type:    v1alpha1.MachineAvailableCondition,
+		Status:  metav1.ConditionTrue,
+		Reason:  "ConnectivityTestSucceeded",
+		Message: fmt.Sprintf("Managed to establish a connection to the machine at %s", address),
 	}
-	conn, err := net.Dial("tcp", fmt.Sprintf("%s:%d", machine.Spec.IP, port))
-	if err != nil {
-		t.Recorder.Event(machine, "Warning", "ConnectivityTestFailed", err.Error())
-		ready = false
-		oldAvailable, ok := conditions["Available"]
-		newAvailable := metav1.Condition{
-			Type:               "Available",
-			Status:             metav1.ConditionFalse,
-			Reason:             "ConnectivityTestFailed",
-			Message:            err.Error(),
-			ObservedGeneration: oldAvailable.ObservedGeneration,
-			LastTransitionTime: oldAvailable.LastTransitionTime,
-		}
-		if oldAvailable.Status == metav1.ConditionTrue || !ok {
-			newAvailable.ObservedGeneration = machine.Generation
-			newAvailable.LastTransitionTime = metav1.Now()
-		}
-		conditions["Available"] = newAvailable
+	probeStart := time.Now()
+	conn, dialErr := net.Dial("tcp", address)
+	probeResult := "success"
+	if dialErr != nil {
+		probeResult = "failure"
+	}
+	machineProbeDuration.WithLabelValues(probeResult).Observe(time.Since(probeStart).Seconds())
+	if dialErr != nil {
+		t.Recorder.Event(machine, "Warning", "ConnectivityTestFailed", dialErr.Error())
+		available.Status = metav1.ConditionFalse
+		available.Reason = "ConnectivityTestFailed"
+		available.Message = dialErr.Error()
 	} else {
 		defer conn.Close()
-		oldAvailable, ok := conditions["Available"]
-		newAvailable := metav1.Condition{
-			Type:               "Available",
-			Status:             metav1.ConditionTrue,
-			Reason:             "ConnectivityTestSucceeded",
-			Message:            fmt.Sprintf("Managed to establish a connection to the machine at %s:%d", machine.Spec.IP, port),
-			ObservedGeneration: oldAvailable.ObservedGeneration,
-			LastTransitionTime: oldAvailable.LastTransitionTime,
-		}
-		if oldAvailable.Status == metav1.ConditionFalse || !ok {
-			newAvailable.ObservedGeneration = machine.Generation
-			newAvailable.LastTransitionTime = metav1.Now()
-		}
-		conditions["Available"] = newAvailable
 	}
 
-	if !ready {
-		t.Recorder.Event(machine, "Warning", "Unready", "One or more checks failed")
-		oldReady, ok := conditions["Ready"]
-		newReady := metav1.Condition{
-			Type:               "Ready",
-			Status:             metav1.ConditionFalse,
-			Reason:             "ChecksFailed",
-			Message:            "One or more checks failed",
-			ObservedGeneration: oldReady.ObservedGeneration,
-			LastTransitionTime: oldReady.LastTransitionTime,
-		}
-		if oldReady.Status == metav1.ConditionTrue || !ok {
-			newReady.ObservedGeneration = machine.Generation
-			newReady.LastTransitionTime = metav1.Now()
-		}
-		conditions["Ready"] = newReady
+	err := patchStatus(ctx, t.Client, MachineControllerName, machine, func(m *v1alpha1.Machine) {
+		conditions.Set(m, available)
+		conditions.SetSummary(m, machineReadyDependents...)
+		m.Status.ObservedGeneration = m.Generation
+	})
+	if err != nil {
+		slog.Error("unable to update machine status", "error", err)
+		return ctrl.Result{}, err
+	}
 
-		machine.Status.Conditions = slices.Collect(maps.Values(conditions))
+	deleted, err := t.reconcileRegistration(ctx, machine)
+	if err != nil {
+		slog.Error("unable to reconcile machine registration", "error", err)
+		return ctrl.Result{}, err
+	}
+	if deleted {
+		return ctrl.Result{}, nil
+	}
 
-		statusErr := t.Status().Update(ctx, machine)
-		if statusErr != nil {
-			slog.Error("unable to update machine status", "error", statusErr)
-		}
-		return ctrl.Result{RequeueAfter: 5 * time.Second}, err
+	if err := t.reconcilePower(ctx, machine); err != nil {
+		slog.Error("unable to reconcile machine power", "error", err)
+		return ctrl.Result{}, err
 	}
 
-	oldReady, ok := conditions["Ready"]
-	newReady := metav1.Condition{
-		Type:               "Ready",
-		Status:             metav1.ConditionTrue,
-		Reason:             "Ready",
-		Message:            "All checks passed",
-		ObservedGeneration: oldReady.ObservedGeneration,
-		LastTransitionTime: oldReady.LastTransitionTime,
+	pending, err := t.reconcileMaintenance(ctx, machine)
+	if err != nil {
+		slog.Error("unable to reconcile machine maintenance", "error", err)
+		return ctrl.Result{}, err
 	}
-	if oldReady.Status == metav1.ConditionFalse || !ok {
-		newReady.ObservedGeneration = machine.Generation
-		newReady.LastTransitionTime = metav1.Now()
+	if machine.InMaintenance() {
+		if pending {
+			return ctrl.Result{RequeueAfter: t.Config.MachineBackoffBase}, nil
+		}
+		return ctrl.Result{RequeueAfter: jitter(t.Config.MachineResyncInterval, t.Config.MachineBackoffJitter)}, nil
 	}
-	conditions["Ready"] = newReady
 
-	machine.Status.Conditions = slices.Collect(maps.Values(conditions))
+	if !conditions.IsTrue(machine, conditions.Ready) {
+		t.Recorder.Event(machine, "Warning", "Unready", "One or more checks failed")
 
-	err = t.Status().Update(ctx, machine)
-	if err != nil {
-		slog.Error("unable to update machine status", "error", err)
+		delay := t.backoff.Next(req.NamespacedName)
+		slog.Info("machine unready, backing off", "machine", req.NamespacedName, "failures", t.backoff.Failures(req.NamespacedName), "delay", delay)
+		return ctrl.Result{RequeueAfter: delay}, nil
 	}
+	t.backoff.Reset(req.NamespacedName)
 
-	node := &v1alpha1.Node{}
-	if err = t.Get(ctx, req.NamespacedName, node); err != nil && !k8serrors.IsNotFound(err) {
-		slog.Error("unable to get node", "error", err)
+	node := &v1alpha1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      machine.Name,
+			Namespace: machine.Namespace,
+		},
+	}
+	_, err = controllerutil.CreateOrPatch(ctx, t.Client, node, func() error {
+		return controllerutil.SetControllerReference(machine, node, t.Scheme)
+	})
+	if err != nil {
+		slog.Error("unable to create or update node", "error", err)
 		return ctrl.Result{}, err
 	}
 
-	if node.Name == "" {
-		node.Name = machine.Name
-		node.Namespace = machine.Namespace
+	if err := t.reconcileDrift(ctx, machine); err != nil {
+		slog.Error("unable to reconcile machine config drift", "error", err)
+		return ctrl.Result{}, err
 	}
 
-	return ctrl.Result{}, nil
+	return ctrl.Result{RequeueAfter: jitter(t.Config.MachineResyncInterval, t.Config.MachineBackoffJitter)}, nil
+}
+
+// clusterReadyDependents are the conditions summarised into the Ready condition of a Cluster.
+var clusterReadyDependents = []string{
+	v1alpha1.ClusterCredentialsCondition,
+	v1alpha1.ClusterHealthyCondition,
+	v1alpha1.ClusterSchematicsCondition,
 }
 
 type TalosClusterReconciler struct {
 	client.Client
 	Scheme   *runtime.Scheme
 	Recorder record.EventRecorder
+	Talos    *talosclient.Pool
+	Factory  *imagefactory.Client
+	Config   Config
 }
 
 func (t *TalosClusterReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	t.Recorder = mgr.GetEventRecorderFor("talos-cluster-controller")
+	t.Recorder = mgr.GetEventRecorderFor(ClusterControllerName)
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&v1alpha1.Cluster{}).
-		Complete(t)
+		For(&v1alpha1.Cluster{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Watches(&v1alpha1.Machine{}, handler.EnqueueRequestsFromMapFunc(t.clustersForMachine),
+			builder.WithPredicates(watched(t.Config), predicate.Or(predicate.GenerationChangedPredicate{}, predicate.LabelChangedPredicate{}))).
+		// Only the metadata of Secrets is cached, the talosconfig itself is read from the API server when it is used.
+		Watches(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(t.clustersForSecret), builder.OnlyMetadata).
+		Complete(&tracedReconciler{controller: ClusterControllerName, Reconciler: t})
 }
 
-// "github.com/siderolabs/talos/pkg/machinery/client"
+// watched filters out the Machines of namespaces the operator does not manage.
+func watched(cfg Config) predicate.Predicate {
+	return predicate.NewPredicateFuncs(func(obj client.Object) bool {
+		return cfg.Watches(obj.GetNamespace())
+	})
+}
+
+// clustersForSecret maps a Secret to every Cluster using it as talosconfig, so rotated credentials are picked up.
+func (t *TalosClusterReconciler) clustersForSecret(ctx context.Context, obj client.Object) []reconcile.Request {
+	clusters := &v1alpha1.ClusterList{}
+	if err := t.List(ctx, clusters); err != nil {
+		slog.Error("unable to list clusters", "error", err)
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, cluster := range clusters.Items {
+		if name, _ := t.Config.ClusterTalosConfigSecret(&cluster); name == client.ObjectKeyFromObject(obj) {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&cluster)})
+		}
+	}
+
+	return requests
+}
+
+// clustersForMachine maps a Machine to every Cluster with a MachineSet selecting it. Updates are mapped for both the
+// old and the new object, so a Cluster is also notified when a Machine stops matching its selectors.
+func (t *TalosClusterReconciler) clustersForMachine(ctx context.Context, obj client.Object) []reconcile.Request {
+	clusters := &v1alpha1.ClusterList{}
+	if err := t.List(ctx, clusters); err != nil {
+		slog.Error("unable to list clusters", "error", err)
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, cluster := range clusters.Items {
+		if clusterSelects(&cluster, obj) {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&cluster)})
+		}
+	}
+
+	return requests
+}
+
+// clusterSelects reports whether any MachineSet of the Cluster selects the Machine.
+func clusterSelects(cluster *v1alpha1.Cluster, machine client.Object) bool {
+	return machineSetFor(cluster, machine) != nil
+}
+
+// machineSetFor returns the first MachineSet of the Cluster selecting the Machine, or nil if there is none.
+func machineSetFor(cluster *v1alpha1.Cluster, machine client.Object) *v1alpha1.MachineSet {
+	if ns := cluster.MachinesNamespace(); ns != "" && ns != machine.GetNamespace() {
+		return nil
+	}
+
+	for _, set := range cluster.Spec.MachineSets() {
+		selector, err := set.MachineSelector()
+		if err != nil {
+			slog.Error("invalid machine selector", "cluster", cluster.Name, "machineSet", set.Name, "error", err)
+			continue
+		}
+		if selector.Matches(labels.Set(machine.GetLabels())) {
+			return &set
+		}
+	}
+
+	return nil
+}
 
 func (t *TalosClusterReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	cluster := &v1alpha1.Cluster{}
@@ -171,33 +271,79 @@ func (t *TalosClusterReconciler) Reconcile(ctx context.Context, req ctrl.Request
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
 
-	machines := &v1alpha1.MachineList{}
+	endpoints, err := controlPlaneEndpoints(ctx, t.Client, t.Config, cluster)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
 
-	machineSelector, err := metav1.LabelSelectorAsSelector(&cluster.Spec.Nodes.Selector)
+	machineSets, schematics := t.reconcileSchematics(ctx, cluster)
+
+	secretName, secretKey := t.Config.ClusterTalosConfigSecret(cluster)
+	credentials, err := talosclient.LoadSecretCredentials(ctx, t.Client, secretName, secretKey)
+	if err != nil {
+		t.Recorder.Event(cluster, "Warning", "CredentialsUnavailable", err.Error())
+		// The Secret watch requeues the Cluster once the talosconfig is fixed.
+		return ctrl.Result{}, patchStatus(ctx, t.Client, ClusterControllerName, cluster, func(c *v1alpha1.Cluster) {
+			conditions.MarkFalse(c, v1alpha1.ClusterCredentialsCondition, "CredentialsUnavailable", err.Error())
+			conditions.Set(c, schematics)
+			c.Status.MachineSets = machineSets
+			conditions.SetSummary(c, clusterReadyDependents...)
+			c.Status.ObservedGeneration = c.Generation
+		})
+	}
+
+	ctl, err := t.Talos.Client(ctx, credentials, endpoints...)
 	if err != nil {
 		return ctrl.Result{}, err
 	}
-	if err := t.List(ctx, machines, client.MatchingLabelsSelector{Selector: machineSelector}); err != nil {
+
+	healthy := metav1.Condition{
+		Type:    v1alpha1.ClusterHealthyCondition,
+		Status:  metav1.ConditionTrue,
+		Reason:  "HealthCheckPassed",
+		Message: "Cluster health check passed",
+	}
+	healthErr := observeTalosCall("cluster_health_check", func() error { return t.checkHealth(ctx, ctl) })
+	if healthErr != nil {
+		t.Recorder.Event(cluster, "Warning", "HealthCheckFailed", healthErr.Error())
+		healthy.Status = metav1.ConditionFalse
+		healthy.Reason = "HealthCheckFailed"
+		healthy.Message = healthErr.Error()
+	}
+
+	err = patchStatus(ctx, t.Client, ClusterControllerName, cluster, func(c *v1alpha1.Cluster) {
+		conditions.MarkTrue(c, v1alpha1.ClusterCredentialsCondition, "CredentialsLoaded",
+			fmt.Sprintf("Loaded talosconfig from secret %s", secretName))
+		conditions.Set(c, healthy)
+		conditions.Set(c, schematics)
+		conditions.SetSummary(c, clusterReadyDependents...)
+		c.Status.MachineSets = machineSets
+		c.Status.ObservedGeneration = c.Generation
+	})
+	if err != nil {
 		return ctrl.Result{}, err
 	}
 
-	var endpoints []string
-	for _, m := range machines.Items {
-		port := m.Spec.Port
-		if port == 0 {
-			port = 50000
-		}
-		endpoints = append(endpoints, m.Spec.IP)
+	if healthErr != nil {
+		return ctrl.Result{}, healthErr
 	}
 
-	ctl, err := talosctl.New(ctx, talosctl.WithEndpoints(endpoints...), talosctl.WithConfigFromFile("/var/run/secrets/talos.dev"))
+	pending, err := t.rolloutInstallerImages(ctx, &talosInstaller{ctl: ctl}, cluster, machineSets)
 	if err != nil {
+		t.Recorder.Event(cluster, "Warning", "UpgradeFailed", err.Error())
 		return ctrl.Result{}, err
 	}
+	if pending {
+		return ctrl.Result{RequeueAfter: t.Config.RolloutInterval}, nil
+	}
+
+	return ctrl.Result{}, nil
+}
 
+func (t *TalosClusterReconciler) checkHealth(ctx context.Context, ctl *talosctl.Client) error {
 	hcClient, err := ctl.ClusterHealthCheck(ctx, time.Minute, &clusterapi.ClusterInfo{})
 	if err != nil {
-		return ctrl.Result{}, err
+		return err
 	}
 
 	for {
@@ -208,11 +354,9 @@ func (t *TalosClusterReconciler) Reconcile(ctx context.Context, req ctrl.Request
 
 		if err != nil {
 			if errors.Is(err, io.EOF) {
-				break
+				return nil
 			}
-			return ctrl.Result{}, err
+			return err
 		}
 	}
-
-	return ctrl.Result{}, nil
 }
@@ -2,6 +2,8 @@ package operator
 
 import (
 	"context"
+	"errors"
+	"io/fs"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
@@ -22,7 +24,9 @@ import (
 	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	"sigs.k8s.io/controller-runtime/pkg/envtest"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
 func TestTalosMachineReconciler_Reconcile(t *testing.T) {
@@ -40,10 +44,16 @@ func TestTalosMachineReconciler_Reconcile(t *testing.T) {
 	require.NoError(t, err)
 
 	binPath := ""
-	// TODO traverse parents
-	rootDir, err := filepath.Abs(path.Join(pwd, "..", "..", ".."))
-	require.NoError(t, err)
-	require.NoError(t, filepath.WalkDir(path.Join(rootDir, "bin", "k8s"), func(path string, d os.DirEntry, err error) error {
+	rootDir := pwd
+	for {
+		if _, err := os.Stat(path.Join(rootDir, "go.mod")); err == nil {
+			break
+		}
+		parent := filepath.Dir(rootDir)
+		require.NotEqual(t, rootDir, parent, "unable to locate repository root")
+		rootDir = parent
+	}
+	err = filepath.WalkDir(path.Join(rootDir, "bin", "k8s"), func(path string, d os.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
@@ -64,9 +74,11 @@ func TestTalosMachineReconciler_Reconcile(t *testing.T) {
 		}
 
 		return nil
-	}))
-
-	require.NotEmpty(t, binPath)
+	})
+	if errors.Is(err, fs.ErrNotExist) || binPath == "" {
+		t.Skip("envtest binaries not found, run go generate in the repository root")
+	}
+	require.NoError(t, err)
 
 	testEnv := &envtest.Environment{
 		CRDDirectoryPaths:     []string{path.Join(rootDir, "crds")},
@@ -90,6 +102,7 @@ func TestTalosMachineReconciler_Reconcile(t *testing.T) {
 	reconciler := &TalosMachineReconciler{
 		Client: k8sClient,
 		Scheme: scheme,
+		Config: DefaultConfig(),
 	}
 	require.NoError(t, reconciler.SetupWithManager(mgr))
 
@@ -125,10 +138,11 @@ func TestTalosMachineReconciler_Reconcile(t *testing.T) {
 			require.NoError(t, k8sClient.Delete(ctx, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: machine.Namespace}}))
 		})
 
-		_, err = reconciler.Reconcile(ctx, ctrl.Request{
+		result, err := reconciler.Reconcile(ctx, ctrl.Request{
 			NamespacedName: types.NamespacedName{Namespace: machine.Namespace, Name: machine.Name},
 		})
 		require.NoError(t, err)
+		assert.GreaterOrEqual(t, result.RequeueAfter, reconciler.Config.MachineResyncInterval)
 
 		var m v1alpha1.Machine
 		require.NoError(t, k8sClient.Get(ctx, types.NamespacedName{Namespace: machine.Namespace, Name: machine.Name}, &m))
@@ -167,10 +181,11 @@ func TestTalosMachineReconciler_Reconcile(t *testing.T) {
 			require.NoError(t, k8sClient.Delete(ctx, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: machine.Namespace}}))
 		})
 
-		_, err = reconciler.Reconcile(ctx, ctrl.Request{
+		result, err := reconciler.Reconcile(ctx, ctrl.Request{
 			NamespacedName: types.NamespacedName{Namespace: machine.Namespace, Name: machine.Name},
 		})
-		assert.Error(t, err)
+		require.NoError(t, err)
+		assert.GreaterOrEqual(t, result.RequeueAfter, reconciler.Config.MachineBackoffBase)
 
 		var m v1alpha1.Machine
 		require.NoError(t, k8sClient.Get(ctx, types.NamespacedName{Namespace: machine.Namespace, Name: machine.Name}, &m))
@@ -188,3 +203,136 @@ func TestTalosMachineReconciler_Reconcile(t *testing.T) {
 		}
 	})
 }
+
+func TestTalosClusterReconciler_clustersForMachine(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, v1alpha1.AddToScheme(scheme))
+
+	controlPlane := &v1alpha1.Cluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "control-plane", Namespace: "clusters"},
+		Spec: v1alpha1.ClusterSpec{
+			Nodes: v1alpha1.MachineSet{
+				Name:     "control-plane",
+				Selector: metav1.LabelSelector{MatchLabels: map[string]string{"role": "control-plane"}},
+			},
+			MachineNamespace: "machines",
+		},
+	}
+	workers := &v1alpha1.Cluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "workers", Namespace: "clusters"},
+		Spec: v1alpha1.ClusterSpec{
+			Nodes: v1alpha1.MachineSet{
+				Name:     "control-plane",
+				Selector: metav1.LabelSelector{MatchLabels: map[string]string{"role": "other"}},
+			},
+			WorkerSets: []v1alpha1.MachineSet{{
+				Name:     "workers",
+				Selector: metav1.LabelSelector{MatchLabels: map[string]string{"role": "worker"}},
+			}},
+			MachineNamespace: v1alpha1.AllMachineNamespaces,
+		},
+	}
+
+	tenant := &v1alpha1.Cluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "tenant", Namespace: "team-a"},
+		Spec: v1alpha1.ClusterSpec{
+			Nodes: v1alpha1.MachineSet{
+				Name:     "control-plane",
+				Selector: metav1.LabelSelector{MatchLabels: map[string]string{"role": "tenant"}},
+			},
+			MachineNamespace: "team-a",
+		},
+	}
+
+	// Without a MachineNamespace, only Machines of the Cluster's own namespace are selected.
+	own := &v1alpha1.Cluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "own", Namespace: "team-b"},
+		Spec: v1alpha1.ClusterSpec{
+			Nodes: v1alpha1.MachineSet{
+				Name:     "control-plane",
+				Selector: metav1.LabelSelector{MatchLabels: map[string]string{"role": "team-b"}},
+			},
+		},
+	}
+
+	// A Cluster without selectors must not claim every Machine.
+	unset := &v1alpha1.Cluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "unset", Namespace: "clusters"},
+		Spec:       v1alpha1.ClusterSpec{Nodes: v1alpha1.MachineSet{Name: "control-plane"}},
+	}
+
+	reconciler := &TalosClusterReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(controlPlane, workers, tenant, own, unset).Build(),
+		Scheme: scheme,
+	}
+
+	tests := []struct {
+		name      string
+		namespace string
+		labels    map[string]string
+		expected  []string
+	}{
+		{name: "control plane selector", labels: map[string]string{"role": "control-plane"}, expected: []string{"control-plane"}},
+		{name: "worker set selector", labels: map[string]string{"role": "worker"}, expected: []string{"workers"}},
+		{name: "every machine namespace", namespace: "team-a", labels: map[string]string{"role": "worker"}, expected: []string{"workers"}},
+		{name: "no matching selector", labels: map[string]string{"role": "none"}},
+		{name: "unlabelled machine"},
+		{name: "machine namespace", namespace: "team-a", labels: map[string]string{"role": "tenant"}, expected: []string{"tenant"}},
+		{name: "other machine namespace", labels: map[string]string{"role": "tenant"}},
+		{name: "cluster namespace", namespace: "team-b", labels: map[string]string{"role": "team-b"}, expected: []string{"own"}},
+		{name: "outside cluster namespace", labels: map[string]string{"role": "team-b"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			namespace := tt.namespace
+			if namespace == "" {
+				namespace = "machines"
+			}
+			machine := &v1alpha1.Machine{
+				ObjectMeta: metav1.ObjectMeta{Name: "m1", Namespace: namespace, Labels: tt.labels},
+			}
+
+			var names []string
+			for _, request := range reconciler.clustersForMachine(context.Background(), machine) {
+				names = append(names, request.Name)
+			}
+			assert.Equal(t, tt.expected, names)
+		})
+	}
+}
+
+func TestTalosClusterReconciler_clustersForSecret(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, v1alpha1.AddToScheme(scheme))
+
+	shared := &v1alpha1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "shared", Namespace: "clusters"}}
+	own := &v1alpha1.Cluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "own", Namespace: "team-a"},
+		Spec:       v1alpha1.ClusterSpec{TalosConfigRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "talosconfig"}}},
+	}
+
+	config := DefaultConfig()
+	config.Namespace = "operator"
+	reconciler := &TalosClusterReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(shared, own).Build(),
+		Scheme: scheme,
+		Config: config,
+	}
+
+	// The Secret watch only delivers metadata.
+	secret := func(namespace, name string) client.Object {
+		return &metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}}
+	}
+	names := func(requests []reconcile.Request) []string {
+		var names []string
+		for _, request := range requests {
+			names = append(names, request.Name)
+		}
+		return names
+	}
+
+	assert.Equal(t, []string{"shared"}, names(reconciler.clustersForSecret(context.Background(), secret("operator", config.ConfigSecretName))))
+	assert.Equal(t, []string{"own"}, names(reconciler.clustersForSecret(context.Background(), secret("team-a", "talosconfig"))))
+	assert.Empty(t, reconciler.clustersForSecret(context.Background(), secret("team-b", "talosconfig")))
+}
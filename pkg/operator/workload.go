@@ -0,0 +1,225 @@
+package operator
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/lukaspj/talos-cluster-operator/pkg/api/v1alpha1"
+	"github.com/lukaspj/talos-cluster-operator/pkg/talosclient"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// WorkloadNodes manages the Kubernetes node of a Machine in the workload cluster claiming it.
+type WorkloadNodes interface {
+	// Cordon marks the node unschedulable, or schedulable again.
+	Cordon(ctx context.Context, machine *v1alpha1.Machine, unschedulable bool) error
+	// Drain evicts the pods of the node which are not managed by a DaemonSet. It returns the number of pods still
+	// to be evicted, as evictions blocked by a PodDisruptionBudget are retried on the next call.
+	Drain(ctx context.Context, machine *v1alpha1.Machine) (int, error)
+}
+
+// KubernetesWorkloadNodes talks to workload clusters through the kubeconfig handed out by their Talos API.
+type KubernetesWorkloadNodes struct {
+	Client client.Reader
+	Talos  *talosclient.Pool
+	Config Config
+
+	mu      sync.Mutex
+	clients map[string]kubernetes.Interface
+}
+
+func (k *KubernetesWorkloadNodes) Cordon(ctx context.Context, machine *v1alpha1.Machine, unschedulable bool) error {
+	kube, node, err := k.node(ctx, machine)
+	if err != nil || node.Spec.Unschedulable == unschedulable {
+		return err
+	}
+
+	patch := fmt.Sprintf(`{"spec":{"unschedulable":%t}}`, unschedulable)
+	_, err = kube.CoreV1().Nodes().Patch(ctx, node.Name, types.MergePatchType, []byte(patch), metav1.PatchOptions{FieldManager: MachineControllerName})
+
+	return err
+}
+
+func (k *KubernetesWorkloadNodes) Drain(ctx context.Context, machine *v1alpha1.Machine) (int, error) {
+	kube, node, err := k.node(ctx, machine)
+	if err != nil {
+		return 0, err
+	}
+
+	pods, err := kube.CoreV1().Pods("").List(ctx, metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("spec.nodeName", node.Name).String(),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	remaining := 0
+	for _, pod := range pods.Items {
+		if !evictable(&pod) {
+			continue
+		}
+
+		err := kube.PolicyV1().Evictions(pod.Namespace).Evict(ctx, &policyv1.Eviction{
+			ObjectMeta: metav1.ObjectMeta{Name: pod.Name, Namespace: pod.Namespace},
+		})
+		switch {
+		case k8serrors.IsNotFound(err):
+		case k8serrors.IsTooManyRequests(err):
+			remaining++
+		case err != nil:
+			return 0, fmt.Errorf("unable to evict pod %s/%s: %w", pod.Namespace, pod.Name, err)
+		default:
+			// Evicted pods terminate gracefully and are counted until they are gone.
+			remaining++
+		}
+	}
+
+	return remaining, nil
+}
+
+// evictable reports whether draining has to evict the pod. DaemonSet pods and static pods stay on the node, and
+// finished pods need no eviction.
+func evictable(pod *corev1.Pod) bool {
+	if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+		return false
+	}
+	if _, ok := pod.Annotations[corev1.MirrorPodAnnotationKey]; ok {
+		return false
+	}
+	if owner := metav1.GetControllerOf(pod); owner != nil && owner.Kind == "DaemonSet" {
+		return false
+	}
+
+	return true
+}
+
+// node returns the Kubernetes node of the machine, matched by its internal IP or name.
+func (k *KubernetesWorkloadNodes) node(ctx context.Context, machine *v1alpha1.Machine) (kubernetes.Interface, *corev1.Node, error) {
+	kube, err := k.kubernetes(ctx, machine)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	nodes, err := kube.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, node := range nodes.Items {
+		if node.Name == machine.Name {
+			return kube, &node, nil
+		}
+		for _, address := range node.Status.Addresses {
+			if address.Type == corev1.NodeInternalIP && address.Address == machine.Spec.IP {
+				return kube, &node, nil
+			}
+		}
+	}
+
+	return nil, nil, fmt.Errorf("no node of machine %s in cluster %s", machine.Name, machine.Status.Cluster)
+}
+
+// kubernetes returns a client for the workload cluster claiming the machine.
+func (k *KubernetesWorkloadNodes) kubernetes(ctx context.Context, machine *v1alpha1.Machine) (kubernetes.Interface, error) {
+	if machine.Status.Cluster == "" {
+		return nil, fmt.Errorf("machine %s is not claimed by a cluster", machine.Name)
+	}
+
+	namespace, name, _ := strings.Cut(machine.Status.Cluster, "/")
+	cluster := &v1alpha1.Cluster{}
+	if err := k.Client.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, cluster); err != nil {
+		return nil, err
+	}
+
+	secretName, secretKey := k.Config.ClusterTalosConfigSecret(cluster)
+	credentials, err := talosclient.LoadSecretCredentials(ctx, k.Client, secretName, secretKey)
+	if err != nil {
+		return nil, err
+	}
+	endpoints, err := controlPlaneEndpoints(ctx, k.Client, k.Config, cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	key := machine.Status.Cluster + "/" + credentials.ID()
+	k.mu.Lock()
+	kube, ok := k.clients[key]
+	k.mu.Unlock()
+	if ok {
+		return kube, nil
+	}
+
+	ctl, err := k.Talos.Client(ctx, credentials, endpoints...)
+	if err != nil {
+		return nil, err
+	}
+	var kubeconfig []byte
+	err = observeTalosCall("kubeconfig", func() (err error) {
+		kubeconfig, err = ctl.Kubeconfig(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get kubeconfig of cluster %s: %w", machine.Status.Cluster, err)
+	}
+	restConfig, err := clientcmd.RESTConfigFromKubeConfig(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	kube, err = kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.clients == nil {
+		k.clients = map[string]kubernetes.Interface{}
+	}
+	k.clients[key] = kube
+
+	return kube, nil
+}
+
+// listMachineSet lists the Machines of the MachineSet in the namespaces the operator manages. A selector matching
+// nothing lists nothing, the API server would list every Machine for it.
+func listMachineSet(ctx context.Context, c client.Reader, cfg Config, cluster *v1alpha1.Cluster, set *v1alpha1.MachineSet) ([]v1alpha1.Machine, error) {
+	selector, err := set.MachineSelector()
+	if err != nil {
+		return nil, err
+	}
+	if _, selectable := selector.Requirements(); !selectable {
+		return nil, nil
+	}
+
+	machines := &v1alpha1.MachineList{}
+	if err := c.List(ctx, machines, client.MatchingLabelsSelector{Selector: selector}, client.InNamespace(cluster.MachinesNamespace())); err != nil {
+		return nil, err
+	}
+
+	return slices.DeleteFunc(machines.Items, func(m v1alpha1.Machine) bool { return !cfg.Watches(m.Namespace) }), nil
+}
+
+// controlPlaneEndpoints returns the addresses of the control plane machines of the Cluster.
+func controlPlaneEndpoints(ctx context.Context, c client.Reader, cfg Config, cluster *v1alpha1.Cluster) ([]string, error) {
+	machines, err := listMachineSet(ctx, c, cfg, cluster, &cluster.Spec.Nodes)
+	if err != nil {
+		return nil, err
+	}
+
+	var endpoints []string
+	for _, m := range machines {
+		endpoints = append(endpoints, m.Spec.IP)
+	}
+
+	return endpoints, nil
+}
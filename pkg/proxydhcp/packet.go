@@ -0,0 +1,173 @@
+// Package proxydhcp implements a proxy DHCP responder as described by the PXE specification. It answers PXE
+// clients with a boot file but never assigns addresses, leaving leases to the DHCP servers already on the network.
+package proxydhcp
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"slices"
+	"strings"
+)
+
+const (
+	opRequest = 1
+	opReply   = 2
+
+	OptionPad            = 0
+	OptionVendorSpecific = 43
+	OptionMessageType    = 53
+	OptionServerID       = 54
+	OptionVendorClass    = 60
+	OptionUserClass      = 77
+	OptionClientArch     = 93
+	OptionClientUUID     = 97
+	OptionEnd            = 255
+
+	MessageDiscover = 1
+	MessageOffer    = 2
+	MessageRequest  = 3
+	MessageAck      = 5
+)
+
+const headerLen = 236
+
+var magicCookie = []byte{99, 130, 83, 99}
+
+// Packet is a DHCPv4 message.
+type Packet struct {
+	Op      uint8
+	HType   uint8
+	HLen    uint8
+	Hops    uint8
+	XID     uint32
+	Secs    uint16
+	Flags   uint16
+	CIAddr  net.IP
+	YIAddr  net.IP
+	SIAddr  net.IP
+	GIAddr  net.IP
+	CHAddr  net.HardwareAddr
+	SName   string
+	File    string
+	Options map[uint8][]byte
+}
+
+// Parse decodes a DHCPv4 message.
+func Parse(b []byte) (*Packet, error) {
+	if len(b) < headerLen+len(magicCookie) {
+		return nil, errors.New("packet too short")
+	}
+	if !slices.Equal(b[headerLen:headerLen+len(magicCookie)], magicCookie) {
+		return nil, errors.New("missing dhcp magic cookie")
+	}
+
+	p := &Packet{
+		Op:      b[0],
+		HType:   b[1],
+		HLen:    b[2],
+		Hops:    b[3],
+		XID:     binary.BigEndian.Uint32(b[4:8]),
+		Secs:    binary.BigEndian.Uint16(b[8:10]),
+		Flags:   binary.BigEndian.Uint16(b[10:12]),
+		CIAddr:  net.IP(slices.Clone(b[12:16])),
+		YIAddr:  net.IP(slices.Clone(b[16:20])),
+		SIAddr:  net.IP(slices.Clone(b[20:24])),
+		GIAddr:  net.IP(slices.Clone(b[24:28])),
+		SName:   cString(b[44:108]),
+		File:    cString(b[108:236]),
+		Options: map[uint8][]byte{},
+	}
+	if p.HLen > 16 {
+		return nil, errors.New("invalid hardware address length")
+	}
+	p.CHAddr = net.HardwareAddr(slices.Clone(b[28 : 28+p.HLen]))
+
+	opts := b[headerLen+len(magicCookie):]
+	for len(opts) > 0 {
+		code := opts[0]
+		switch code {
+		case OptionPad:
+			opts = opts[1:]
+			continue
+		case OptionEnd:
+			return p, nil
+		}
+		if len(opts) < 2 || len(opts) < 2+int(opts[1]) {
+			return nil, errors.New("truncated option")
+		}
+		// Options which are split over several entries are concatenated (RFC 3396).
+		p.Options[code] = append(p.Options[code], opts[2:2+opts[1]]...)
+		opts = opts[2+opts[1]:]
+	}
+
+	return p, nil
+}
+
+// Marshal encodes the message, writing the message type option first.
+func (p *Packet) Marshal() []byte {
+	b := make([]byte, headerLen, 576)
+	b[0], b[1], b[2], b[3] = p.Op, p.HType, p.HLen, p.Hops
+	binary.BigEndian.PutUint32(b[4:8], p.XID)
+	binary.BigEndian.PutUint16(b[8:10], p.Secs)
+	binary.BigEndian.PutUint16(b[10:12], p.Flags)
+	copy(b[12:16], p.CIAddr.To4())
+	copy(b[16:20], p.YIAddr.To4())
+	copy(b[20:24], p.SIAddr.To4())
+	copy(b[24:28], p.GIAddr.To4())
+	copy(b[28:44], p.CHAddr)
+	copy(b[44:107], p.SName)
+	copy(b[108:235], p.File)
+	b = append(b, magicCookie...)
+
+	codes := make([]uint8, 0, len(p.Options))
+	for code := range p.Options {
+		codes = append(codes, code)
+	}
+	slices.SortFunc(codes, func(a, b uint8) int {
+		switch {
+		case a == b:
+			return 0
+		case a == OptionMessageType:
+			return -1
+		case b == OptionMessageType:
+			return 1
+		}
+		return int(a) - int(b)
+	})
+
+	for _, code := range codes {
+		value := p.Options[code]
+		for {
+			chunk := value[:min(len(value), 255)]
+			b = append(b, code, uint8(len(chunk)))
+			b = append(b, chunk...)
+			value = value[len(chunk):]
+			if len(value) == 0 {
+				break
+			}
+		}
+	}
+	b = append(b, OptionEnd)
+
+	// Some PXE ROMs drop replies shorter than a minimal BOOTP message.
+	for len(b) < 300 {
+		b = append(b, OptionPad)
+	}
+
+	return b
+}
+
+// MessageType returns the DHCP message type, or 0 for plain BOOTP messages.
+func (p *Packet) MessageType() uint8 {
+	if v := p.Options[OptionMessageType]; len(v) == 1 {
+		return v[0]
+	}
+
+	return 0
+}
+
+func cString(b []byte) string {
+	s, _, _ := strings.Cut(string(b), "\x00")
+	return s
+}
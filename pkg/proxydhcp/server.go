@@ -0,0 +1,255 @@
+package proxydhcp
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+)
+
+// Client architecture types (RFC 4578, IANA processor architecture types).
+const (
+	archBIOS         = 0
+	archEFIx64       = 7
+	archEFIBC        = 9
+	archEFIArm64     = 11
+	archEFIx64HTTP   = 16
+	archEFIArm64HTTP = 19
+)
+
+// Discovery is a PXE client seen by the responder.
+type Discovery struct {
+	MAC net.HardwareAddr
+	// UUID is the client machine identifier, usually the SMBIOS UUID, as sent in option 97.
+	UUID []byte
+	// Arch is the Talos architecture of the client, amd64 or arm64.
+	Arch string
+	// IPXE is set when the client is already running iPXE.
+	IPXE bool
+}
+
+type Config struct {
+	// ServerIP is advertised as the server identifier of every reply.
+	ServerIP net.IP
+	// TFTPServer serves iPXE to PXE ROMs which cannot boot over HTTP, the responder does not serve TFTP itself.
+	TFTPServer net.IP
+	// BootURL is the base URL of the boot service, which serves /boot/ipxe and /boot/assets/{arch}/ipxe.efi.
+	BootURL string
+	// Addr and BootAddr are the DHCP and PXE boot server listen addresses, :67 and :4011 when empty.
+	Addr     string
+	BootAddr string
+}
+
+// Server answers DHCPDISCOVERs of PXE clients on the DHCP port and DHCPREQUESTs on the PXE boot server port.
+type Server struct {
+	Config Config
+	// OnDiscover is called for every PXE client seen.
+	OnDiscover func(Discovery)
+
+	// broadcast is where replies to clients without an address go.
+	broadcast *net.UDPAddr
+
+	dhcp *net.UDPConn
+	boot *net.UDPConn
+}
+
+// Listen opens the DHCP and PXE boot server sockets.
+func Listen(conf Config, onDiscover func(Discovery)) (*Server, error) {
+	if conf.ServerIP.To4() == nil {
+		return nil, errors.New("proxy dhcp needs an IPv4 server address")
+	}
+	if conf.TFTPServer.To4() == nil {
+		return nil, errors.New("proxy dhcp needs an IPv4 tftp server address")
+	}
+
+	s := &Server{
+		Config:     conf,
+		OnDiscover: onDiscover,
+		broadcast:  &net.UDPAddr{IP: net.IPv4bcast, Port: 68},
+	}
+
+	var err error
+	if s.dhcp, err = listen(conf.Addr, ":67"); err != nil {
+		return nil, err
+	}
+	if s.boot, err = listen(conf.BootAddr, ":4011"); err != nil {
+		_ = s.dhcp.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func listen(addr, fallback string) (*net.UDPConn, error) {
+	if addr == "" {
+		addr = fallback
+	}
+	udpAddr, err := net.ResolveUDPAddr("udp4", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return net.ListenUDP("udp4", udpAddr)
+}
+
+// Serve answers requests until the context is cancelled.
+func (s *Server) Serve(ctx context.Context) error {
+	go func() {
+		<-ctx.Done()
+		_ = s.dhcp.Close()
+		_ = s.boot.Close()
+	}()
+
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i, conn := range []*net.UDPConn{s.dhcp, s.boot} {
+		wg.Go(func() {
+			errs[i] = s.serve(ctx, conn)
+		})
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+func (s *Server) serve(ctx context.Context, conn *net.UDPConn) error {
+	buf := make([]byte, 1500)
+	for {
+		n, addr, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		req, err := Parse(buf[:n])
+		if err != nil {
+			slog.Debug("ignoring malformed dhcp packet", "from", addr, "error", err)
+			continue
+		}
+
+		reply, ok := s.reply(req, conn == s.boot)
+		if !ok {
+			continue
+		}
+
+		to := addr
+		if conn == s.dhcp {
+			to = s.broadcast
+			if !req.GIAddr.IsUnspecified() {
+				to = &net.UDPAddr{IP: req.GIAddr, Port: 67}
+			}
+		}
+		if _, err := conn.WriteToUDP(reply.Marshal(), to); err != nil {
+			slog.Error("unable to send proxy dhcp reply", "to", to, "error", err)
+		}
+	}
+}
+
+// reply builds the answer to a PXE client. DISCOVERs on the DHCP port are answered with an OFFER and REQUESTs on
+// the boot server port with an ACK; everything else belongs to the real DHCP server.
+func (s *Server) reply(req *Packet, bootPort bool) (*Packet, bool) {
+	if req.Op != opRequest {
+		return nil, false
+	}
+
+	vendorClass := string(req.Options[OptionVendorClass])
+	httpClient := strings.HasPrefix(vendorClass, "HTTPClient")
+	if !strings.HasPrefix(vendorClass, "PXEClient") && !httpClient {
+		return nil, false
+	}
+
+	var messageType uint8
+	switch {
+	case !bootPort && req.MessageType() == MessageDiscover:
+		messageType = MessageOffer
+	case bootPort && req.MessageType() == MessageRequest:
+		messageType = MessageAck
+	default:
+		return nil, false
+	}
+
+	arch := uint16(archBIOS)
+	if v := req.Options[OptionClientArch]; len(v) >= 2 {
+		arch = binary.BigEndian.Uint16(v)
+	}
+
+	discovery := Discovery{
+		MAC:  req.CHAddr,
+		Arch: "amd64",
+		IPXE: string(req.Options[OptionUserClass]) == "iPXE",
+	}
+	if arch == archEFIArm64 || arch == archEFIArm64HTTP {
+		discovery.Arch = "arm64"
+	}
+	if v := req.Options[OptionClientUUID]; len(v) == 17 && v[0] == 0 {
+		discovery.UUID = v[1:]
+	}
+
+	siaddr, file, err := s.bootFile(discovery, arch, httpClient)
+	if err != nil {
+		slog.Info("not answering pxe client", "mac", req.CHAddr, "arch", arch, "reason", err)
+		return nil, false
+	}
+
+	if messageType == MessageOffer && s.OnDiscover != nil {
+		s.OnDiscover(discovery)
+	}
+	slog.Info("answering pxe client", "mac", req.CHAddr, "arch", arch, "ipxe", discovery.IPXE, "file", file)
+
+	reply := &Packet{
+		Op:     opReply,
+		HType:  req.HType,
+		HLen:   req.HLen,
+		XID:    req.XID,
+		Flags:  req.Flags,
+		CIAddr: req.CIAddr,
+		YIAddr: net.IPv4zero,
+		SIAddr: siaddr,
+		GIAddr: req.GIAddr,
+		CHAddr: req.CHAddr,
+		File:   file,
+		Options: map[uint8][]byte{
+			OptionMessageType: {messageType},
+			OptionServerID:    s.Config.ServerIP.To4(),
+			OptionVendorClass: []byte("PXEClient"),
+			// PXE discovery control: skip boot server discovery and use the boot file of this reply.
+			OptionVendorSpecific: {6, 1, 8, OptionEnd},
+		},
+	}
+	if httpClient {
+		reply.Options[OptionVendorClass] = []byte("HTTPClient")
+		delete(reply.Options, OptionVendorSpecific)
+	}
+	if v, ok := req.Options[OptionClientUUID]; ok {
+		reply.Options[OptionClientUUID] = v
+	}
+
+	return reply, true
+}
+
+// bootFile returns the server and file a client boots next. Clients running iPXE get the boot script, UEFI HTTP
+// boot clients get iPXE from the boot service and PXE ROMs get iPXE over TFTP.
+func (s *Server) bootFile(d Discovery, arch uint16, httpClient bool) (net.IP, string, error) {
+	bootURL := strings.TrimSuffix(s.Config.BootURL, "/")
+
+	switch {
+	case d.IPXE:
+		return s.Config.ServerIP, bootURL + "/boot/ipxe", nil
+	case httpClient && (arch == archEFIx64HTTP || arch == archEFIArm64HTTP):
+		return s.Config.ServerIP, fmt.Sprintf("%s/boot/assets/%s/ipxe.efi", bootURL, d.Arch), nil
+	case arch == archBIOS:
+		return s.Config.TFTPServer, "undionly.kpxe", nil
+	case arch == archEFIx64 || arch == archEFIBC:
+		return s.Config.TFTPServer, "ipxe.efi", nil
+	case arch == archEFIArm64:
+		return s.Config.TFTPServer, "ipxe-arm64.efi", nil
+	default:
+		return nil, "", fmt.Errorf("unsupported client architecture %d", arch)
+	}
+}
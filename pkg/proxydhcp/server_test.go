@@ -0,0 +1,162 @@
+package proxydhcp
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func discover(mac net.HardwareAddr, messageType uint8, options map[uint8][]byte) *Packet {
+	p := &Packet{
+		Op:      opRequest,
+		HType:   1,
+		HLen:    6,
+		XID:     0xdeadbeef,
+		CIAddr:  net.IPv4zero,
+		YIAddr:  net.IPv4zero,
+		SIAddr:  net.IPv4zero,
+		GIAddr:  net.IPv4zero,
+		CHAddr:  mac,
+		Options: map[uint8][]byte{OptionMessageType: {messageType}},
+	}
+	for code, value := range options {
+		p.Options[code] = value
+	}
+
+	return p
+}
+
+func TestPacket_Roundtrip(t *testing.T) {
+	mac, _ := net.ParseMAC("aa:bb:cc:dd:ee:ff")
+	p := discover(mac, MessageDiscover, map[uint8][]byte{OptionVendorClass: []byte("PXEClient:Arch:00000")})
+	p.File = "undionly.kpxe"
+
+	got, err := Parse(p.Marshal())
+	require.NoError(t, err)
+	assert.Equal(t, mac, got.CHAddr)
+	assert.Equal(t, uint32(0xdeadbeef), got.XID)
+	assert.Equal(t, "undionly.kpxe", got.File)
+	assert.Equal(t, uint8(MessageDiscover), got.MessageType())
+	assert.Equal(t, "PXEClient:Arch:00000", string(got.Options[OptionVendorClass]))
+
+	_, err = Parse([]byte{1, 2, 3})
+	assert.Error(t, err)
+}
+
+func TestServer_reply(t *testing.T) {
+	mac, _ := net.ParseMAC("aa:bb:cc:dd:ee:ff")
+	s := &Server{Config: Config{
+		ServerIP:   net.IPv4(10, 0, 0, 2),
+		TFTPServer: net.IPv4(10, 0, 0, 3),
+		BootURL:    "http://10.0.0.2:4242",
+	}}
+
+	tests := []struct {
+		name     string
+		req      *Packet
+		bootPort bool
+		siaddr   net.IP
+		file     string
+	}{
+		{
+			name:   "bios pxe rom chainloads ipxe over tftp",
+			req:    discover(mac, MessageDiscover, map[uint8][]byte{OptionVendorClass: []byte("PXEClient:Arch:00000"), OptionClientArch: {0, 0}}),
+			siaddr: net.IPv4(10, 0, 0, 3),
+			file:   "undionly.kpxe",
+		},
+		{
+			name:   "ipxe gets the boot script",
+			req:    discover(mac, MessageDiscover, map[uint8][]byte{OptionVendorClass: []byte("PXEClient:Arch:00007"), OptionClientArch: {0, 7}, OptionUserClass: []byte("iPXE")}),
+			siaddr: net.IPv4(10, 0, 0, 2),
+			file:   "http://10.0.0.2:4242/boot/ipxe",
+		},
+		{
+			name:   "uefi http boot gets ipxe over http",
+			req:    discover(mac, MessageDiscover, map[uint8][]byte{OptionVendorClass: []byte("HTTPClient:Arch:00019"), OptionClientArch: {0, 19}}),
+			siaddr: net.IPv4(10, 0, 0, 2),
+			file:   "http://10.0.0.2:4242/boot/assets/arm64/ipxe.efi",
+		},
+		{
+			name:     "boot server request is acknowledged",
+			req:      discover(mac, MessageRequest, map[uint8][]byte{OptionVendorClass: []byte("PXEClient:Arch:00007"), OptionClientArch: {0, 7}}),
+			bootPort: true,
+			siaddr:   net.IPv4(10, 0, 0, 3),
+			file:     "ipxe.efi",
+		},
+		{
+			name: "non pxe clients are left to the dhcp server",
+			req:  discover(mac, MessageDiscover, map[uint8][]byte{OptionVendorClass: []byte("MSFT 5.0")}),
+		},
+		{
+			name: "requests on the dhcp port are left to the dhcp server",
+			req:  discover(mac, MessageRequest, map[uint8][]byte{OptionVendorClass: []byte("PXEClient")}),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reply, ok := s.reply(tt.req, tt.bootPort)
+			if tt.file == "" {
+				assert.False(t, ok)
+				return
+			}
+			require.True(t, ok)
+			assert.True(t, tt.siaddr.Equal(reply.SIAddr))
+			assert.Equal(t, tt.file, reply.File)
+			assert.True(t, reply.YIAddr.IsUnspecified())
+			assert.Equal(t, []byte(net.IPv4(10, 0, 0, 2).To4()), reply.Options[OptionServerID])
+		})
+	}
+}
+
+func TestServer_Serve(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	discovered := make(chan Discovery, 1)
+	s, err := Listen(Config{
+		ServerIP:   net.IPv4(127, 0, 0, 1),
+		TFTPServer: net.IPv4(127, 0, 0, 2),
+		BootURL:    "http://127.0.0.1:4242",
+		Addr:       "127.0.0.1:0",
+		BootAddr:   "127.0.0.1:0",
+	}, func(d Discovery) { discovered <- d })
+	require.NoError(t, err)
+
+	client, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer client.Close()
+	s.broadcast = client.LocalAddr().(*net.UDPAddr)
+
+	go func() { _ = s.Serve(ctx) }()
+
+	mac, _ := net.ParseMAC("aa:bb:cc:dd:ee:ff")
+	uuid := append([]byte{0}, make([]byte, 16)...)
+	uuid[1] = 0x42
+	req := discover(mac, MessageDiscover, map[uint8][]byte{
+		OptionVendorClass: []byte("PXEClient:Arch:00000"),
+		OptionClientUUID:  uuid,
+	})
+	_, err = client.WriteToUDP(req.Marshal(), s.dhcp.LocalAddr().(*net.UDPAddr))
+	require.NoError(t, err)
+
+	require.NoError(t, client.SetReadDeadline(time.Now().Add(5*time.Second)))
+	buf := make([]byte, 1500)
+	n, err := client.Read(buf)
+	require.NoError(t, err)
+
+	reply, err := Parse(buf[:n])
+	require.NoError(t, err)
+	assert.Equal(t, uint8(MessageOffer), reply.MessageType())
+	assert.Equal(t, "undionly.kpxe", reply.File)
+	assert.Equal(t, net.IPv4(127, 0, 0, 2).To4(), reply.SIAddr.To4())
+	assert.Equal(t, uuid, reply.Options[OptionClientUUID])
+
+	d := <-discovered
+	assert.Equal(t, mac, d.MAC)
+	assert.Equal(t, uuid[1:], d.UUID)
+}
@@ -0,0 +1,103 @@
+// Package readyz runs the readiness checks of the operator and the config server.
+package readyz
+
+import (
+	"context"
+	"maps"
+	"net/http"
+	"path"
+	"sync"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+)
+
+// Timeout bounds a probe, every check of it shares the deadline. It exceeds the default probe timeout of a second,
+// the chart raises the timeout of the readiness probes above it.
+const Timeout = 5 * time.Second
+
+// Check is a readiness check, failing when its dependency is not usable.
+type Check func(ctx context.Context) error
+
+// Concurrent returns checkers running the checks of a probe concurrently. healthz.Handler calls the checkers of a
+// probe one after another with the same request, the first call runs the checks of the probe and the others pick up
+// their outcome, so a probe takes at most Timeout however many checks fail.
+func Concurrent(checks map[string]Check) map[string]healthz.Checker {
+	p := &probes{checks: checks, rounds: map[*http.Request]*round{}}
+
+	checkers := make(map[string]healthz.Checker, len(checks))
+	for name := range checks {
+		checkers[name] = func(req *http.Request) error {
+			return p.result(req, name)
+		}
+	}
+
+	return checkers
+}
+
+type probes struct {
+	checks map[string]Check
+
+	mu     sync.Mutex
+	rounds map[*http.Request]*round
+}
+
+// round holds the outcome of the checks of one probe.
+type round struct {
+	done chan struct{}
+	errs map[string]error
+}
+
+func (p *probes) result(req *http.Request, name string) error {
+	p.mu.Lock()
+	r, ok := p.rounds[req]
+	if !ok {
+		r = &round{done: make(chan struct{}), errs: make(map[string]error, len(p.checks))}
+		p.rounds[req] = r
+		go p.run(req.Context(), p.selected(req), r)
+		// The outcome is kept for the other checkers of the probe until it has been answered.
+		context.AfterFunc(req.Context(), func() {
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			delete(p.rounds, req)
+		})
+	}
+	p.mu.Unlock()
+
+	<-r.done
+	return r.errs[name]
+}
+
+// selected returns the checks the probe asks for, a single one for /readyz/{check} or every check not excluded
+// through ?exclude.
+func (p *probes) selected(req *http.Request) map[string]Check {
+	if name := path.Base(req.URL.Path); p.checks[name] != nil {
+		return map[string]Check{name: p.checks[name]}
+	}
+
+	checks := maps.Clone(p.checks)
+	for _, name := range req.URL.Query()["exclude"] {
+		delete(checks, name)
+	}
+
+	return checks
+}
+
+func (p *probes) run(ctx context.Context, checks map[string]Check, r *round) {
+	defer close(r.done)
+
+	ctx, cancel := context.WithTimeout(ctx, Timeout)
+	defer cancel()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Go(func() {
+			err := check(ctx)
+			mu.Lock()
+			defer mu.Unlock()
+			r.errs[name] = err
+		})
+	}
+	wg.Wait()
+}
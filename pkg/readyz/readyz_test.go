@@ -0,0 +1,48 @@
+package readyz
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+)
+
+func TestConcurrent(t *testing.T) {
+	// Each check waits for the other to start, which only passes when they run at the same time.
+	started := map[string]chan struct{}{"a": make(chan struct{}), "b": make(chan struct{})}
+	var runs atomic.Int32
+	waitFor := func(self, other string, err error) Check {
+		return func(ctx context.Context) error {
+			runs.Add(1)
+			close(started[self])
+			select {
+			case <-started[other]:
+				return err
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+	checks := map[string]Check{
+		"a":     waitFor("a", "b", nil),
+		"b":     waitFor("b", "a", errors.New("b is down")),
+		"other": func(context.Context) error { t.Error("excluded check ran"); return nil },
+	}
+	handler := &healthz.Handler{Checks: Concurrent(checks)}
+
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	res, err := http.Get(srv.URL + "/?verbose&exclude=other")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer res.Body.Close()
+
+	assert.Equal(t, http.StatusInternalServerError, res.StatusCode)
+	assert.EqualValues(t, 2, runs.Load(), "every check runs once per probe")
+}
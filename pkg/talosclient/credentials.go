@@ -0,0 +1,78 @@
+package talosclient
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	talosctl "github.com/siderolabs/talos/pkg/machinery/client"
+	clientconfig "github.com/siderolabs/talos/pkg/machinery/client/config"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Credentials describe how a Talos client authenticates.
+type Credentials interface {
+	// ID identifies the credentials in the pool. It must change whenever the credentials are rotated.
+	ID() string
+	// Options returns the client options applying the credentials.
+	Options() []talosctl.OptionFunc
+}
+
+// FileCredentials reads the talosconfig from a file path.
+type FileCredentials string
+
+func (f FileCredentials) ID() string {
+	return "file:" + string(f)
+}
+
+func (f FileCredentials) Options() []talosctl.OptionFunc {
+	return []talosctl.OptionFunc{talosctl.WithConfigFromFile(string(f))}
+}
+
+// ConfigCredentials is a talosconfig read from a Secret. Its ID includes a hash of the talosconfig, so rotating
+// the Secret yields a new client from the pool.
+type ConfigCredentials struct {
+	id     string
+	config *clientconfig.Config
+}
+
+func (c *ConfigCredentials) ID() string {
+	return c.id
+}
+
+func (c *ConfigCredentials) Options() []talosctl.OptionFunc {
+	return []talosctl.OptionFunc{talosctl.WithConfig(c.config)}
+}
+
+// SecretCredentials parses the talosconfig stored under key in the Secret.
+func SecretCredentials(secret *corev1.Secret, key string) (*ConfigCredentials, error) {
+	data, ok := secret.Data[key]
+	if !ok {
+		return nil, fmt.Errorf("secret %s/%s has no key %q", secret.Namespace, secret.Name, key)
+	}
+
+	config, err := clientconfig.FromBytes(data)
+	if err != nil {
+		return nil, fmt.Errorf("secret %s/%s does not contain a valid talosconfig: %w", secret.Namespace, secret.Name, err)
+	}
+
+	sum := sha256.Sum256(data)
+
+	return &ConfigCredentials{
+		id:     fmt.Sprintf("secret:%s/%s/%s@%s", secret.Namespace, secret.Name, key, hex.EncodeToString(sum[:8])),
+		config: config,
+	}, nil
+}
+
+// LoadSecretCredentials reads the Secret and parses the talosconfig stored under key.
+func LoadSecretCredentials(ctx context.Context, c client.Reader, name types.NamespacedName, key string) (*ConfigCredentials, error) {
+	secret := &corev1.Secret{}
+	if err := c.Get(ctx, name, secret); err != nil {
+		return nil, fmt.Errorf("unable to get talosconfig secret %s: %w", name, err)
+	}
+
+	return SecretCredentials(secret, key)
+}
@@ -0,0 +1,43 @@
+package talosclient
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const talosconfig = `context: mgmt
+contexts:
+  mgmt:
+    endpoints:
+      - 10.0.0.1
+`
+
+func TestSecretCredentials(t *testing.T) {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "talos-config", Namespace: "talos-cluster-operator"},
+		Data:       map[string][]byte{"config": []byte(talosconfig)},
+	}
+
+	credentials, err := SecretCredentials(secret, "config")
+	require.NoError(t, err)
+	assert.Contains(t, credentials.ID(), "secret:talos-cluster-operator/talos-config/config@")
+	assert.Len(t, credentials.Options(), 1)
+
+	t.Run("rotation changes the id", func(t *testing.T) {
+		rotated := secret.DeepCopy()
+		rotated.Data["config"] = []byte(talosconfig + "    nodes:\n      - 10.0.0.2\n")
+
+		rotatedCredentials, err := SecretCredentials(rotated, "config")
+		require.NoError(t, err)
+		assert.NotEqual(t, credentials.ID(), rotatedCredentials.ID())
+	})
+
+	t.Run("missing key", func(t *testing.T) {
+		_, err := SecretCredentials(secret, "other")
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,144 @@
+// Package talosclient provides a shared cache of Talos API clients.
+package talosclient
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	talosctl "github.com/siderolabs/talos/pkg/machinery/client"
+)
+
+type key struct {
+	credentials string
+	endpoints   string
+}
+
+type entry struct {
+	client   *talosctl.Client
+	lastUsed time.Time
+}
+
+// Pool caches Talos clients per set of endpoints and credentials, so the gRPC connection and its TLS session are
+// reused across reconciles and requests. Clients that have not been used for the idle timeout are closed.
+type Pool struct {
+	idleTimeout time.Duration
+
+	mu      sync.Mutex
+	clients map[key]*entry
+	closed  bool
+}
+
+func NewPool(idleTimeout time.Duration) *Pool {
+	return &Pool{
+		idleTimeout: idleTimeout,
+		clients:     make(map[key]*entry),
+	}
+}
+
+// Client returns the cached client for the credentials and endpoints, creating it if needed. The order of the
+// endpoints does not matter. Without endpoints the endpoints of the credentials' talosconfig context are used.
+// The returned client is owned by the pool and must not be closed by the caller.
+func (p *Pool) Client(ctx context.Context, credentials Credentials, endpoints ...string) (*talosctl.Client, error) {
+	endpoints = slices.Sorted(slices.Values(endpoints))
+	k := key{
+		credentials: credentials.ID(),
+		endpoints:   strings.Join(slices.Compact(endpoints), ","),
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return nil, errors.New("talos client pool is closed")
+	}
+
+	if e, ok := p.clients[k]; ok {
+		e.lastUsed = time.Now()
+		return e.client, nil
+	}
+
+	opts := credentials.Options()
+	if len(endpoints) > 0 {
+		opts = append(opts, talosctl.WithEndpoints(endpoints...))
+	}
+
+	c, err := talosctl.New(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	p.clients[k] = &entry{client: c, lastUsed: time.Now()}
+
+	return c, nil
+}
+
+// Len returns the number of cached clients.
+func (p *Pool) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return len(p.clients)
+}
+
+// Evict closes every client which has been idle since before the given time.
+func (p *Pool) Evict(before time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for k, e := range p.clients {
+		if e.lastUsed.Before(before) {
+			p.close(k, e)
+		}
+	}
+}
+
+// Start evicts idle clients until the context is cancelled and then closes the pool. It implements
+// manager.Runnable so the pool can be added to a controller manager.
+func (p *Pool) Start(ctx context.Context) error {
+	ticker := time.NewTicker(max(p.idleTimeout/2, time.Second))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return p.Close()
+		case now := <-ticker.C:
+			p.Evict(now.Add(-p.idleTimeout))
+		}
+	}
+}
+
+// NeedLeaderElection makes the pool run on every replica, not just the leader.
+func (p *Pool) NeedLeaderElection() bool {
+	return false
+}
+
+// Close closes every cached client. Clients can no longer be obtained from a closed pool.
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var err error
+	for k, e := range p.clients {
+		err = errors.Join(err, p.close(k, e))
+	}
+	p.closed = true
+
+	return err
+}
+
+func (p *Pool) close(k key, e *entry) error {
+	delete(p.clients, k)
+
+	err := e.client.Close()
+	if err != nil {
+		slog.Warn("unable to close talos client", "endpoints", k.endpoints, "error", err)
+	}
+
+	return err
+}
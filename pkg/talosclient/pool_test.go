@@ -0,0 +1,84 @@
+package talosclient
+
+import (
+	"context"
+	"crypto/tls"
+	"sync"
+	"testing"
+	"time"
+
+	talosctl "github.com/siderolabs/talos/pkg/machinery/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testCredentials string
+
+func (c testCredentials) ID() string {
+	return string(c)
+}
+
+func (c testCredentials) Options() []talosctl.OptionFunc {
+	return []talosctl.OptionFunc{talosctl.WithTLSConfig(&tls.Config{})}
+}
+
+func TestPool_Client(t *testing.T) {
+	ctx := context.Background()
+
+	pool := NewPool(time.Minute)
+	t.Cleanup(func() { _ = pool.Close() })
+
+	a, err := pool.Client(ctx, testCredentials("a"), "10.0.0.1", "10.0.0.2")
+	require.NoError(t, err)
+
+	t.Run("same endpoints in any order share a client", func(t *testing.T) {
+		b, err := pool.Client(ctx, testCredentials("a"), "10.0.0.2", "10.0.0.1")
+		require.NoError(t, err)
+		assert.Same(t, a, b)
+	})
+
+	t.Run("other credentials get their own client", func(t *testing.T) {
+		b, err := pool.Client(ctx, testCredentials("b"), "10.0.0.1", "10.0.0.2")
+		require.NoError(t, err)
+		assert.NotSame(t, a, b)
+	})
+
+	t.Run("concurrent callers share a client", func(t *testing.T) {
+		var wg sync.WaitGroup
+		clients := make([]*talosctl.Client, 16)
+		for i := range clients {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				clients[i], _ = pool.Client(ctx, testCredentials("c"), "10.0.0.3")
+			}()
+		}
+		wg.Wait()
+
+		for _, c := range clients {
+			assert.Same(t, clients[0], c)
+		}
+	})
+}
+
+func TestPool_Evict(t *testing.T) {
+	ctx := context.Background()
+
+	pool := NewPool(time.Minute)
+
+	_, err := pool.Client(ctx, testCredentials("a"), "10.0.0.1")
+	require.NoError(t, err)
+	time.Sleep(10 * time.Millisecond)
+	cutoff := time.Now()
+	_, err = pool.Client(ctx, testCredentials("a"), "10.0.0.2")
+	require.NoError(t, err)
+
+	pool.Evict(cutoff)
+	assert.Equal(t, 1, pool.Len())
+
+	require.NoError(t, pool.Close())
+	assert.Equal(t, 0, pool.Len())
+
+	_, err = pool.Client(ctx, testCredentials("a"), "10.0.0.1")
+	assert.Error(t, err)
+}